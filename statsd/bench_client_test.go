@@ -95,3 +95,46 @@ func BenchmarkClientSetIntSample(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkClientIncTags(b *testing.B) {
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	c, err := NewClient(l.LocalAddr().String(), "test")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc("benchinc", 1, 1, Tag{"route", "/"}, Tag{"method", "GET"})
+		}
+	})
+}
+
+func BenchmarkCounterHandleIncTags(b *testing.B) {
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	c, err := NewClient(l.LocalAddr().String(), "test")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+	h := c.(*Client).CounterHandle("benchinc", Tag{"route", "/"}, Tag{"method", "GET"})
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h.Inc(1)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import "sync"
+
+// CardinalityPolicy determines what a Client does with a stat that would
+// exceed the configured tag cardinality limit for its name.
+type CardinalityPolicy uint8
+
+const (
+	// CardinalityDrop silently discards stats for new series. This is the
+	// default.
+	CardinalityDrop CardinalityPolicy = iota
+	// CardinalityCollapse replaces previously unseen tag values with a
+	// placeholder, and sends the stat with the collapsed tags.
+	CardinalityCollapse
+)
+
+// CardinalityLimitedStat is the name of the counter a Client emits when a
+// stat is dropped or collapsed by the tag cardinality limiter. It is sent
+// with the prefix of the Client or SubStatter in use, and a "stat" tag
+// holding the full name of the limited stat.
+const CardinalityLimitedStat = "statsd.cardinality_limited"
+
+// CardinalityLimitedRate is the sample rate of the CardinalityLimitedStat
+// counter, so that it does not add much traffic while stats are limited. It
+// is sampled by the sampler of the Client.
+const CardinalityLimitedRate = 0.01
+
+// defaultCardinalityNames is the default maximum number of stat names whose
+// series are tracked.
+const defaultCardinalityNames = 10000
+
+type cardinalityAction uint8
+
+const (
+	cardinalityAllow cardinalityAction = iota
+	cardinalityDrop
+	cardinalityCollapse
+)
+
+// cardinalityLimiter tracks the distinct tag combinations (series) seen for
+// each full stat name. It is shared by a Client and its SubStatters.
+type cardinalityLimiter struct {
+	limit       int
+	policy      CardinalityPolicy
+	placeholder string
+
+	// series of each name, by name
+	names *nameCache
+}
+
+// cardinalityName holds the series seen for a full stat name.
+type cardinalityName struct {
+	mx sync.RWMutex
+	// series keys seen so far: tag keys and values
+	series map[string]struct{}
+	// values seen per tag key, only kept when collapsing
+	values map[string]map[string]struct{}
+}
+
+// newCardinalityLimiter returns a cardinalityLimiter, or nil if limit is 0.
+// maxNames is the maximum number of names tracked, defaulting to
+// defaultCardinalityNames if 0.
+func newCardinalityLimiter(limit int, policy CardinalityPolicy, placeholder string, maxNames int) *cardinalityLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	if placeholder == "" {
+		placeholder = "other"
+	}
+	if maxNames <= 0 {
+		maxNames = defaultCardinalityNames
+	}
+
+	return &cardinalityLimiter{
+		limit:       limit,
+		policy:      policy,
+		placeholder: placeholder,
+		names:       newNameCache(maxNames),
+	}
+}
+
+// name returns the series of the stat prefix.stat, tracking it if needed.
+func (l *cardinalityLimiter) name(prefix, stat string) *cardinalityName {
+	if n, ok := l.names.get(prefix, stat); ok {
+		return n.(*cardinalityName)
+	}
+
+	n := &cardinalityName{series: make(map[string]struct{})}
+	if l.policy == CardinalityCollapse {
+		n.values = make(map[string]map[string]struct{})
+	}
+	return l.names.add(joinName(prefix, stat), n).(*cardinalityName)
+}
+
+// check determines whether a stat with the supplied name and tags may be
+// sent. If the action is cardinalityCollapse, the returned tags are a
+// collapsed copy. scratch is used to build the series key, and is returned
+// for reuse.
+func (l *cardinalityLimiter) check(scratch []byte, prefix, stat string, tags []Tag) ([]byte, []Tag, cardinalityAction) {
+	n := l.name(prefix, stat)
+	scratch = appendSeriesKey(scratch, tags)
+
+	// the string conversion in a map index expression does not allocate
+	n.mx.RLock()
+	_, ok := n.series[string(scratch)]
+	n.mx.RUnlock()
+	if ok {
+		return scratch, tags, cardinalityAllow
+	}
+
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	if _, ok := n.series[string(scratch)]; ok {
+		return scratch, tags, cardinalityAllow
+	}
+
+	if len(n.series) < l.limit {
+		n.series[string(scratch)] = struct{}{}
+		if l.policy == CardinalityCollapse {
+			for _, t := range tags {
+				vals, ok := n.values[t[0]]
+				if !ok {
+					vals = make(map[string]struct{})
+					n.values[t[0]] = vals
+				}
+				vals[t[1]] = struct{}{}
+			}
+		}
+		return scratch, tags, cardinalityAllow
+	}
+
+	if l.policy == CardinalityDrop {
+		return scratch, tags, cardinalityDrop
+	}
+
+	collapsed := make([]Tag, len(tags))
+	replaced := false
+	for i, t := range tags {
+		collapsed[i] = t
+		if _, ok := n.values[t[0]][t[1]]; !ok {
+			collapsed[i][1] = l.placeholder
+			replaced = true
+		}
+	}
+	if !replaced {
+		// only known values, but in a new combination
+		for i := range collapsed {
+			collapsed[i][1] = l.placeholder
+		}
+	}
+	return scratch, collapsed, cardinalityCollapse
+}
+
+// appendSeriesKey appends the key identifying a series of a stat name to
+// data. Tags are sorted, so that their order does not matter.
+func appendSeriesKey(data []byte, tags []Tag) []byte {
+	if !tagsSorted(tags) {
+		tp := tagsPool.Get().(*[]Tag)
+		defer tagsPool.Put(tp)
+		*tp = append((*tp)[:0], tags...)
+		tags = *tp
+		// insertion sort, tags are few
+		for i := 1; i < len(tags); i++ {
+			for j := i; j > 0 && tagLess(tags[j], tags[j-1]); j-- {
+				tags[j], tags[j-1] = tags[j-1], tags[j]
+			}
+		}
+	}
+
+	for _, t := range tags {
+		data = append(data, 0)
+		data = append(data, t[0]...)
+		data = append(data, 0)
+		data = append(data, t[1]...)
+	}
+	return data
+}
+
+// tagsSorted returns whether tags are sorted by key, then value.
+func tagsSorted(tags []Tag) bool {
+	for i := 1; i < len(tags); i++ {
+		if tagLess(tags[i], tags[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagLess orders tags by key, then value.
+func tagLess(a, b Tag) bool {
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+	return a[1] < b[1]
+}
+
+// joinName returns the full stat name, as written by the client.
+func joinName(prefix, stat string) string {
+	if prefix == "" {
+		return stat
+	}
+	return prefix + "." + stat
+}
+
+// appendName appends the full stat name to data.
+func appendName(data []byte, prefix, stat string) []byte {
+	if prefix != "" {
+		data = append(data, prefix...)
+		data = append(data, '.')
+	}
+	return append(data, stat...)
+}
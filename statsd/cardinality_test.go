@@ -0,0 +1,153 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestClientTagCardinality(t *testing.T) {
+	cardinalityTests := []struct {
+		Policy   CardinalityPolicy
+		Tags     []Tag
+		Expected []string
+	}{
+		// first two series are within the limit
+		{CardinalityDrop, []Tag{{"user", "a"}}, []string{"test.sub.count:1|c|#user:a"}},
+		{CardinalityDrop, []Tag{{"user", "b"}}, []string{"test.sub.count:1|c|#user:b"}},
+		{CardinalityDrop, []Tag{{"user", "a"}}, []string{"test.sub.count:1|c|#user:a"}},
+		{CardinalityDrop, []Tag{{"user", "c"}}, []string{
+			"test.sub.statsd.cardinality_limited:1|c|@0.010000|#stat:test.sub.count",
+		}},
+		{CardinalityCollapse, []Tag{{"user", "a"}}, []string{"test.sub.count:1|c|#user:a"}},
+		{CardinalityCollapse, []Tag{{"user", "b"}}, []string{"test.sub.count:1|c|#user:b"}},
+		{CardinalityCollapse, []Tag{{"user", "c"}}, []string{
+			"test.sub.statsd.cardinality_limited:1|c|@0.010000|#stat:test.sub.count",
+			"test.sub.count:1|c|#user:other",
+		}},
+	}
+
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	clients := map[CardinalityPolicy]Statter{}
+	for _, tt := range cardinalityTests {
+		c, ok := clients[tt.Policy]
+		if !ok {
+			config := &ClientConfig{
+				Address:              l.LocalAddr().String(),
+				Prefix:               "test",
+				TagCardinalityLimit:  2,
+				TagCardinalityPolicy: tt.Policy,
+				// send the sampled CardinalityLimitedStat every time
+				Sampler: func(string, float32, []Tag) bool { return true },
+			}
+			c, err = NewClientWithConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			clients[tt.Policy] = c
+		}
+
+		// use a fresh SubStatter every time, to ensure state is shared
+		err = c.NewSubStatter("sub").Inc("count", 1, 1.0, tt.Tags...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range tt.Expected {
+			data := make([]byte, 128)
+			_, _, err = l.ReadFrom(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data = bytes.TrimRight(data, "\x00")
+			if !bytes.Equal(data, []byte(expected)) {
+				t.Fatalf("got '%s' expected '%s'", data, expected)
+			}
+		}
+	}
+}
+
+func TestCardinalityCollapseKnownValues(t *testing.T) {
+	l := newCardinalityLimiter(2, CardinalityCollapse, "", 0)
+	for _, tags := range [][]Tag{
+		{{"a", "1"}, {"b", "1"}},
+		{{"a", "2"}, {"b", "2"}},
+	} {
+		if _, _, action := l.check(nil, "", "stat", tags); action != cardinalityAllow {
+			t.Fatalf("expected %v to be allowed", tags)
+		}
+	}
+
+	// all values seen before, but not in this combination
+	_, got, action := l.check(nil, "", "stat", []Tag{{"a", "1"}, {"b", "2"}})
+	if action != cardinalityCollapse {
+		t.Fatal("expected new combination to be collapsed")
+	}
+	want := []Tag{{"a", "other"}, {"b", "other"}}
+	if got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %v expected %v", got, want)
+	}
+}
+
+func TestCardinalityTagOrder(t *testing.T) {
+	l := newCardinalityLimiter(1, CardinalityDrop, "", 0)
+	if _, _, action := l.check(nil, "", "stat", []Tag{{"a", "1"}, {"b", "1"}}); action != cardinalityAllow {
+		t.Fatal("expected the first series to be allowed")
+	}
+	// the same series, with tags in another order
+	if _, _, action := l.check(nil, "", "stat", []Tag{{"b", "1"}, {"a", "1"}}); action != cardinalityAllow {
+		t.Fatal("expected reordered tags to be the same series")
+	}
+	if _, _, action := l.check(nil, "", "stat", []Tag{{"b", "2"}, {"a", "1"}}); action != cardinalityDrop {
+		t.Fatal("expected a new series to be dropped")
+	}
+}
+
+func TestCardinalityMaxNames(t *testing.T) {
+	l := newCardinalityLimiter(1, CardinalityDrop, "", 2)
+	tags := []Tag{{"a", "1"}}
+	l.check(nil, "", "one", tags)
+	l.check(nil, "", "two", tags)
+	if _, _, action := l.check(nil, "", "one", []Tag{{"a", "2"}}); action != cardinalityDrop {
+		t.Fatal("expected a new series to be dropped")
+	}
+
+	// a third name resets the tracked series
+	l.check(nil, "", "three", tags)
+	if len(l.names.m) != 1 {
+		t.Fatalf("expected 1 tracked name, got %d", len(l.names.m))
+	}
+	if _, _, action := l.check(nil, "", "one", []Tag{{"a", "2"}}); action != cardinalityAllow {
+		t.Fatal("expected series to be forgotten")
+	}
+}
+
+func TestCardinalityLimitedSampled(t *testing.T) {
+	cs := &captureSender{}
+	c, err := newClientFromConfig(cs, &ClientConfig{
+		Prefix:              "test",
+		TagCardinalityLimit: 1,
+		Sampler: func(stat string, rate float32, tags []Tag) bool {
+			return stat != "test."+CardinalityLimitedStat
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Inc("count", 1, 1, Tag{"user", "a"})
+	c.Inc("count", 1, 1, Tag{"user", "b"})
+	if got := cs.take(); len(got) != 1 || got[0] != "test.count:1|c|#user:a" {
+		t.Fatalf("got %q", got)
+	}
+}
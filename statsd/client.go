@@ -5,15 +5,22 @@
 package statsd
 
 import (
-	"fmt"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var bufPool = newBufferPool()
 
+// tagsPool holds scratch tag slices, see Client.includeStat
+var tagsPool = sync.Pool{New: func() interface{} {
+	tags := make([]Tag, 0, 8)
+	return &tags
+}}
+
 // The StatSender interface wraps all the statsd metric methods
 type StatSender interface {
 	Inc(string, int64, float32, ...Tag) error
@@ -51,10 +58,50 @@ type SubStatter interface {
 	NewSubStatter(string) SubStatter
 }
 
+// The ExtendedSubStatter interface wraps a SubStatter and adds the methods
+// of the SubStatters returned by a Client or MultiStatter. Callers may type
+// assert a SubStatter to it.
+type ExtendedSubStatter interface {
+	SubStatter
+	HandleStatter
+	NewSubStatterWithConfig(*SubStatterConfig) ExtendedSubStatter
+	Prefix() string
+	Parent() SubStatter
+	Flush() error
+	Close() error
+}
+
 // The SamplerFunc type defines a function that can serve
 // as a Client sampler function.
 type SamplerFunc func(float32) bool
 
+// statType identifies the kind of stat being submitted.
+type statType uint8
+
+const (
+	statCount statType = iota
+	statGauge
+	statGaugeDelta
+	statTiming
+	statSet
+	statRaw
+)
+
+// suffix returns the statsd type suffix for the stat type.
+func (t statType) suffix() string {
+	switch t {
+	case statCount:
+		return "|c"
+	case statGauge, statGaugeDelta:
+		return "|g"
+	case statTiming:
+		return "|ms"
+	case statSet:
+		return "|s"
+	}
+	return ""
+}
+
 // DefaultSampler is the default rate sampler function
 func DefaultSampler(rate float32) bool {
 	if rate < 1 {
@@ -65,37 +112,218 @@ func DefaultSampler(rate float32) bool {
 
 // A Client is a statsd client.
 type Client struct {
+	// current settings, a *clientState. settings are replaced as a whole,
+	// never modified, so they may be read without locking.
+	// for a live SubStatter, only its own settings, see load.
+	state atomic.Value
+	// serializes settings changes
+	mx sync.Mutex
+	// the Client this SubStatter was created from, nil for a Client
+	parent *Client
+	// whether settings follow those of parent
+	live bool
+	// settings of a live SubStatter derived from parent, a *derivedState
+	derived atomic.Value
+	// set once a SubStatter is closed
+	closed int32
+}
+
+// derivedState caches the settings of a live SubStatter.
+type derivedState struct {
+	// the parent and own settings st was derived from
+	base *clientState
+	own  *clientState
+	st   *clientState
+}
+
+// clientState holds the settings of a Client.
+type clientState struct {
 	// prefix for statsd name
 	prefix string
-	// packet sender
-	sender Sender
+	// packet sender, shared with SubStatters
+	sender *sharedSender
 	// sampler method
-	sampler SamplerFunc
+	sampler RateSamplerFunc
+	// cache of the full stat names passed to sampler, keyed by full name so
+	// that it is shared with SubStatters
+	samplerNames *samplerNames
 	// tag handler
 	tagFormat TagFormat
+	// stat name and tag sanitizer, nil if disabled
+	sanitizer *sanitizer
+	// stat name validator, nil if disabled
+	validator *nameValidator
+	// tag cardinality limiter, nil if disabled
+	limiter *cardinalityLimiter
+	// tags added to every stat (SubStatter tags)
+	tags []Tag
+	// for the own settings of a live SubStatter: whether sampler replaces
+	// the sampler of the parent
+	ownSampler bool
+	// metric hooks, run in order
+	hooks []MetricHook
+	// stat name filter, nil if disabled
+	filter *nameFilter
+	// stat name rewriter, nil if disabled
+	renamer *renamer
+	// source of InfluxLine timestamps, the system clock if nil
+	clock Clock
+}
+
+// sharedSender holds the Sender shared by a Client and its SubStatters, so
+// that it may be replaced by Reconfigure.
+type sharedSender struct {
+	// current *senderBox
+	v atomic.Value
+}
+
+// senderBox is a Sender, along with the settings it was built from.
+type senderBox struct {
+	Sender
+	// zero if the Sender was supplied by the caller
+	config senderConfig
+}
+
+func newSharedSender(sender Sender, config senderConfig) *sharedSender {
+	ss := &sharedSender{}
+	ss.v.Store(&senderBox{sender, config})
+	return ss
+}
+
+func (ss *sharedSender) load() *senderBox {
+	return ss.v.Load().(*senderBox)
+}
+
+// newClient returns a Client using st as its settings.
+func newClient(st *clientState) *Client {
+	c := &Client{}
+	c.state.Store(st)
+	return c
+}
+
+// load returns the current settings, or nil for a zero Client.
+func (s *Client) load() *clientState {
+	st := s.own()
+	if !s.live || st == nil {
+		return st
+	}
+
+	base := s.parent.load()
+	if base == nil {
+		return nil
+	}
+	d, _ := s.derived.Load().(*derivedState)
+	if d != nil && d.base == base && d.own == st {
+		return d.st
+	}
+
+	// concurrent derivations are identical, so a racing store is harmless
+	ds := *base
+	ds.prefix = joinPathComp(base.prefix, st.prefix)
+	ds.tags = joinTags(base.tags, st.tags)
+	ds.hooks = joinHooks(base.hooks, st.hooks)
+	if st.ownSampler {
+		ds.sampler = st.sampler
+	}
+	s.derived.Store(&derivedState{base: base, own: st, st: &ds})
+	return &ds
+}
+
+// own returns the settings stored in the Client. For a live SubStatter,
+// these are its own settings, applied on top of those of the parent.
+func (s *Client) own() *clientState {
+	st, _ := s.state.Load().(*clientState)
+	return st
+}
+
+// update replaces the settings with a copy modified by fn.
+func (s *Client) update(fn func(*clientState)) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var st clientState
+	if cur := s.own(); cur != nil {
+		st = *cur
+	}
+	fn(&st)
+	s.state.Store(&st)
+}
+
+// isClosed reports whether s, or a SubStatter it was created from, was
+// closed.
+func (s *Client) isClosed() bool {
+	for c := s; c != nil; c = c.parent {
+		if atomic.LoadInt32(&c.closed) != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // Close closes the connection and cleans up.
+//
+// For a SubStatter, Close does not close the sender shared with its parent.
+// It flushes the sender (see Flush) instead, after which stats sent with the
+// SubStatter, or SubStatters created from it, are discarded.
 func (s *Client) Close() error {
 	if s == nil {
 		return nil
 	}
 
-	err := s.sender.Close()
+	st := s.load()
+	if st == nil {
+		return nil
+	}
+
+	if s.parent != nil {
+		if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+			return nil
+		}
+		return st.flush()
+	}
+
+	err := st.sender.load().Close()
 	return err
 }
 
+// Flush sends any stats buffered by the sender, if it is a BufferedSender
+// (or otherwise has a Flush method).
+func (s *Client) Flush() error {
+	if s == nil {
+		return nil
+	}
+
+	st := s.load()
+	if st == nil {
+		return nil
+	}
+	return st.flush()
+}
+
+// flusher is implemented by senders that buffer stats.
+type flusher interface {
+	Flush() error
+}
+
+func (s *clientState) flush() error {
+	if f, ok := s.sender.load().Sender.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
 // Inc increments a statsd count type.
 // stat is a string name for the metric.
 // value is the integer value
 // rate is the sample rate (0.0 to 1.0)
 // tags is a []Tag
 func (s *Client) Inc(stat string, value int64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", value, "|c", rate, tags)
+	return st.submitInt(stat, "", value, statCount, rate, tags)
 }
 
 // Dec decrements a statsd count type.
@@ -103,11 +331,12 @@ func (s *Client) Inc(stat string, value int64, rate float32, tags ...Tag) error
 // value is the integer value.
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) Dec(stat string, value int64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", -value, "|c", rate, tags)
+	return st.submitInt(stat, "", -value, statCount, rate, tags)
 }
 
 // Gauge submits/updates a statsd gauge type.
@@ -115,11 +344,12 @@ func (s *Client) Dec(stat string, value int64, rate float32, tags ...Tag) error
 // value is the integer value.
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) Gauge(stat string, value int64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", value, "|g", rate, tags)
+	return st.submitInt(stat, "", value, statGauge, rate, tags)
 }
 
 // GaugeDelta submits a delta to a statsd gauge.
@@ -127,7 +357,8 @@ func (s *Client) Gauge(stat string, value int64, rate float32, tags ...Tag) erro
 // value is the (positive or negative) change.
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) GaugeDelta(stat string, value int64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
@@ -136,9 +367,9 @@ func (s *Client) GaugeDelta(stat string, value int64, rate float32, tags ...Tag)
 	// don't pull out the prefix here, avoids some tiny amount of stack space by
 	// inlining like this. performance
 	if value >= 0 {
-		return s.submit(stat, "+", value, "|g", rate, tags)
+		return st.submitInt(stat, "+", value, statGaugeDelta, rate, tags)
 	}
-	return s.submit(stat, "", value, "|g", rate, tags)
+	return st.submitInt(stat, "", value, statGaugeDelta, rate, tags)
 }
 
 // GaugeFloat submits/updates a float statsd gauge type.
@@ -147,11 +378,12 @@ func (s *Client) GaugeDelta(stat string, value int64, rate float32, tags ...Tag)
 // value is the float64 value.
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) GaugeFloat(stat string, value float64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", value, "|g", rate, tags)
+	return st.submitFloat(stat, "", value, statGauge, rate, tags)
 }
 
 // GaugeFloatDelta submits a float delta to a statsd gauge.
@@ -160,16 +392,17 @@ func (s *Client) GaugeFloat(stat string, value float64, rate float32, tags ...Ta
 // value is the (positive or negative) change.
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) GaugeFloatDelta(stat string, value float64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
 	// if negative, the submit formatter will prefix with a - already
 	// so only special case the positive value
 	if value >= 0 {
-		return s.submit(stat, "+", value, "|g", rate, tags)
+		return st.submitFloat(stat, "+", value, statGaugeDelta, rate, tags)
 	}
-	return s.submit(stat, "", value, "|g", rate, tags)
+	return st.submitFloat(stat, "", value, statGaugeDelta, rate, tags)
 }
 
 // Timing submits a statsd timing type.
@@ -177,11 +410,12 @@ func (s *Client) GaugeFloatDelta(stat string, value float64, rate float32, tags
 // delta is the time duration value in milliseconds
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) Timing(stat string, delta int64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", delta, "|ms", rate, tags)
+	return st.submitInt(stat, "", delta, statTiming, rate, tags)
 }
 
 // TimingDuration submits a statsd timing type.
@@ -189,12 +423,13 @@ func (s *Client) Timing(stat string, delta int64, rate float32, tags ...Tag) err
 // delta is the timing value as time.Duration
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) TimingDuration(stat string, delta time.Duration, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
 	ms := float64(delta) / float64(time.Millisecond)
-	return s.submit(stat, "", ms, "|ms", rate, tags)
+	return st.submitFloat(stat, "", ms, statTiming, rate, tags)
 }
 
 // Set submits a stats set type
@@ -202,11 +437,12 @@ func (s *Client) TimingDuration(stat string, delta time.Duration, rate float32,
 // value is the string value
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) Set(stat string, value string, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", value, "|s", rate, tags)
+	return st.submitString(stat, value, statSet, rate, tags)
 }
 
 // SetInt submits a number as a stats set type.
@@ -214,11 +450,12 @@ func (s *Client) Set(stat string, value string, rate float32, tags ...Tag) error
 // value is the integer value
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) SetInt(stat string, value int64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", value, "|s", rate, tags)
+	return st.submitInt(stat, "", value, statSet, rate, tags)
 }
 
 // SetFloat submits a number as a stats set type.
@@ -227,11 +464,12 @@ func (s *Client) SetInt(stat string, value int64, rate float32, tags ...Tag) err
 // value is the integer value
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) SetFloat(stat string, value float64, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", value, "|s", rate, tags)
+	return st.submitFloat(stat, "", value, statSet, rate, tags)
 }
 
 // Raw submits a preformatted value.
@@ -239,28 +477,87 @@ func (s *Client) SetFloat(stat string, value float64, rate float32, tags ...Tag)
 // value is a preformatted "raw" value string.
 // rate is the sample rate (0.0 to 1.0).
 func (s *Client) Raw(stat string, value string, rate float32, tags ...Tag) error {
-	if !s.includeStat(rate) {
+	st, rate, ok := s.includeStat(stat, rate, tags)
+	if !ok {
 		return nil
 	}
 
-	return s.submit(stat, "", value, "", rate, tags)
+	return st.submitString(stat, value, statRaw, rate, tags)
 }
 
 // SetSamplerFunc sets a sampler function to something other than the default
 // sampler is a function that determines whether the metric is
 // to be accepted, or discarded.
 // An example use case is for submitted pre-sampled metrics.
+//
+// Setting the sampler of a SubStatter does not change that of its parent.
+// Once set, a live SubStatter no longer follows the sampler of its parent.
 func (s *Client) SetSamplerFunc(sampler SamplerFunc) {
-	s.sampler = sampler
+	var fn RateSamplerFunc
+	if sampler != nil {
+		fn = func(_ string, rate float32, _ []Tag) (float32, bool) {
+			return rate, sampler(rate)
+		}
+	}
+	s.SetRateSamplerFunc(fn)
+}
+
+// SetStatSamplerFunc is like SetSamplerFunc, but sets an extended sampler
+// function, that also receives the stat name and tags.
+func (s *Client) SetStatSamplerFunc(sampler StatSamplerFunc) {
+	s.SetRateSamplerFunc(sampler.rateSampler())
+}
+
+// SetRateSamplerFunc is like SetStatSamplerFunc, but sets a sampler function
+// that may also change the sample rate (eg. AdaptiveSampler.Sample).
+func (s *Client) SetRateSamplerFunc(sampler RateSamplerFunc) {
+	s.update(func(st *clientState) {
+		st.sampler = sampler
+		st.ownSampler = true
+	})
+}
+
+// submitInt submits an already sampled integer stat
+func (s *clientState) submitInt(stat, vprefix string, value int64, kind statType, rate float32, tags []Tag) error {
+	tags, tp := s.withTags(tags)
+	if tp != nil {
+		defer tagsPool.Put(tp)
+	}
+
+	if len(s.hooks) != 0 {
+		return s.runHooks(s.newMetric(stat, kind, value, rate, tags))
+	}
+	return s.writeInt(s.prefix, stat, vprefix, value, kind, rate, tags)
+}
+
+// submitFloat submits an already sampled float stat
+func (s *clientState) submitFloat(stat, vprefix string, value float64, kind statType, rate float32, tags []Tag) error {
+	tags, tp := s.withTags(tags)
+	if tp != nil {
+		defer tagsPool.Put(tp)
+	}
+
+	if len(s.hooks) != 0 {
+		return s.runHooks(s.newMetric(stat, kind, value, rate, tags))
+	}
+	return s.writeFloat(s.prefix, stat, vprefix, value, kind, rate, tags)
 }
 
-// submit an already sampled raw stat
-func (s *Client) submit(stat, vprefix string, value interface{}, suffix string, rate float32, tags []Tag) error {
-	skiptags := false
-	if len(tags) == 0 {
-		skiptags = true
+// submitString submits an already sampled string (set or raw) stat
+func (s *clientState) submitString(stat, value string, kind statType, rate float32, tags []Tag) error {
+	tags, tp := s.withTags(tags)
+	if tp != nil {
+		defer tagsPool.Put(tp)
 	}
 
+	if len(s.hooks) != 0 {
+		return s.runHooks(s.newMetric(stat, kind, value, rate, tags))
+	}
+	return s.writeString(s.prefix, stat, value, kind, rate, tags)
+}
+
+// writeInt formats and sends an integer stat
+func (s *clientState) writeInt(prefix, stat, vprefix string, value int64, kind statType, rate float32, tags []Tag) error {
 	buf := bufPool.Get()
 	defer bufPool.Put(buf)
 	// sadly, no way to jam this back into the bytes.Buffer without
@@ -268,93 +565,396 @@ func (s *Client) submit(stat, vprefix string, value interface{}, suffix string,
 	// so from here on out just use it as a raw []byte
 	data := buf.Bytes()
 
-	if s.prefix != "" {
-		data = append(data, s.prefix...)
+	prefix, stat, tags, tp := s.rename(prefix, stat, tags)
+	if tp != nil {
+		defer tagsPool.Put(tp)
+	}
+
+	prefix, stat, tags, ok, err := s.prepare(data, prefix, stat, tags)
+	if !ok {
+		return err
+	}
+
+	data = s.appendHead(data, prefix, stat, kind, tags)
+	data = s.appendInt(data, vprefix, value, kind)
+	return s.finish(data, kind, rate, tags)
+}
+
+// writeFloat formats and sends a float stat
+func (s *clientState) writeFloat(prefix, stat, vprefix string, value float64, kind statType, rate float32, tags []Tag) error {
+	buf := bufPool.Get()
+	defer bufPool.Put(buf)
+	data := buf.Bytes()
+
+	prefix, stat, tags, tp := s.rename(prefix, stat, tags)
+	if tp != nil {
+		defer tagsPool.Put(tp)
+	}
+
+	prefix, stat, tags, ok, err := s.prepare(data, prefix, stat, tags)
+	if !ok {
+		return err
+	}
+
+	data = s.appendHead(data, prefix, stat, kind, tags)
+	data, err = s.appendFloat(data, vprefix, value, kind)
+	if err != nil {
+		return err
+	}
+	return s.finish(data, kind, rate, tags)
+}
+
+// writeString formats and sends a string (set or raw) stat
+func (s *clientState) writeString(prefix, stat, value string, kind statType, rate float32, tags []Tag) error {
+	buf := bufPool.Get()
+	defer bufPool.Put(buf)
+	data := buf.Bytes()
+
+	prefix, stat, tags, tp := s.rename(prefix, stat, tags)
+	if tp != nil {
+		defer tagsPool.Put(tp)
+	}
+
+	prefix, stat, tags, ok, err := s.prepare(data, prefix, stat, tags)
+	if !ok {
+		return err
+	}
+	if s.sanitizer != nil {
+		if value, err = s.sanitizer.value(value, kind); err != nil {
+			return err
+		}
+	}
+
+	data = s.appendHead(data, prefix, stat, kind, tags)
+	data, err = s.appendString(data, value, kind)
+	if err != nil {
+		return err
+	}
+	return s.finish(data, kind, rate, tags)
+}
+
+// withTags returns tags, preceded by the SubStatter tags, if any. If the
+// returned pooled slice is not nil, it is to be returned to tagsPool once the
+// tags are no longer used.
+func (s *clientState) withTags(tags []Tag) ([]Tag, *[]Tag) {
+	if len(s.tags) == 0 {
+		return tags, nil
+	}
+	tp := tagsPool.Get().(*[]Tag)
+	*tp = append(append((*tp)[:0], s.tags...), tags...)
+	return *tp, tp
+}
+
+// prepare applies sanitizing, validation and tag cardinality limiting to a
+// stat, returning the prefix, stat and tags to write. ok is false if the stat
+// is not to be sent, in which case err is set if it was rejected.
+// scratch is used as temporary space.
+func (s *clientState) prepare(scratch []byte, prefix, stat string, tags []Tag) (string, string, []Tag, bool, error) {
+	if s.sanitizer != nil {
+		var err error
+		prefix, stat, tags, err = s.sanitizer.apply(prefix, stat, tags)
+		if err != nil {
+			return prefix, stat, tags, false, err
+		}
+	}
+
+	if s.validator != nil {
+		r := s.validator.check(prefix, stat)
+		switch {
+		case r.err != nil:
+			return prefix, stat, tags, false, r.err
+		case r.drop:
+			return prefix, stat, tags, false, nil
+		case r.name != "":
+			prefix, stat = "", r.name
+		}
+	}
+
+	if s.limiter != nil && len(tags) != 0 {
+		var action cardinalityAction
+		scratch, tags, action = s.limiter.check(scratch[:0], prefix, stat, tags)
+		if action != cardinalityAllow {
+			s.cardinalityLimited(joinName(prefix, stat))
+			if action == cardinalityDrop {
+				return prefix, stat, tags, false, nil
+			}
+		}
+	}
+
+	return prefix, stat, tags, true, nil
+}
+
+// finish appends the part of a stat following the value to data, and sends
+// it
+func (s *clientState) finish(data []byte, kind statType, rate float32, tags []Tag) error {
+	data = s.appendTail(data, kind, rate)
+	data = s.appendSuffixTags(data, tags)
+
+	_, err := s.sender.load().Send(data)
+	return err
+}
+
+// cardinalityLimited emits the CardinalityLimitedStat counter for name,
+// sampled at CardinalityLimitedRate. Errors are ignored, as the limited stat
+// itself has been handled already.
+func (s *clientState) cardinalityLimited(name string) {
+	tags := []Tag{{"stat", name}}
+	rate, ok := float32(CardinalityLimitedRate), false
+	if s.sampler == nil {
+		ok = DefaultSampler(rate)
+	} else {
+		rate, ok = s.sampler(s.samplerNames.get(s.prefix, CardinalityLimitedStat), rate, tags)
+	}
+	if !ok || !(rate > 0) {
+		return
+	}
+
+	buf := bufPool.Get()
+	defer bufPool.Put(buf)
+	data := s.appendHead(buf.Bytes(), s.prefix, CardinalityLimitedStat, statCount, tags)
+	data = s.appendInt(data, "", 1, statCount)
+	s.finish(data, statCount, rate, tags)
+}
+
+// appendHead appends the part of a stat preceding the value to data
+func (s *clientState) appendHead(data []byte, prefix, stat string, kind statType, tags []Tag) []byte {
+	if s.tagFormat&InfluxLine != 0 {
+		return appendInfluxHead(data, prefix, stat, kind, tags)
+	}
+
+	if prefix != "" {
+		data = append(data, prefix...)
 		data = append(data, '.')
 	}
 
 	data = append(data, stat...)
 
 	// infix tags, if present
-	if !skiptags && s.tagFormat&AllInfix != 0 {
+	if len(tags) != 0 && s.tagFormat&AllInfix != 0 {
 		data = s.tagFormat.WriteInfix(data, tags)
-		// if we did infix already, no suffix also.
-		skiptags = true
 	}
 
-	data = append(data, ':')
+	return append(data, ':')
+}
+
+// appendInt appends an integer value to data
+func (s *clientState) appendInt(data []byte, vprefix string, v int64, kind statType) []byte {
+	if s.tagFormat&InfluxLine != 0 {
+		return appendInfluxInt(data, v, kind)
+	}
+
+	if vprefix != "" {
+		data = append(data, vprefix...)
+	}
+	return strconv.AppendInt(data, v, 10)
+}
+
+// appendFloat appends a float value to data
+func (s *clientState) appendFloat(data []byte, vprefix string, v float64, kind statType) ([]byte, error) {
+	if s.tagFormat&InfluxLine != 0 {
+		return appendInfluxFloat(data, v, kind)
+	}
 
 	if vprefix != "" {
 		data = append(data, vprefix...)
 	}
+	return strconv.AppendFloat(data, v, 'f', -1, 64), nil
+}
 
-	switch v := value.(type) {
-	case string:
-		data = append(data, v...)
-	case int64:
-		data = strconv.AppendInt(data, v, 10)
-	case float64:
-		data = strconv.AppendFloat(data, v, 'f', -1, 64)
-	default:
-		return fmt.Errorf("no matching type format")
+// appendString appends a string (set or raw) value to data
+func (s *clientState) appendString(data []byte, v string, kind statType) ([]byte, error) {
+	if s.tagFormat&InfluxLine != 0 {
+		return appendInfluxStringValue(data, v, kind)
 	}
+	return append(data, v...), nil
+}
 
-	if suffix != "" {
-		data = append(data, suffix...)
+// appendTail appends the part of a stat following the value to data, except
+// for any suffix tags
+func (s *clientState) appendTail(data []byte, kind statType, rate float32) []byte {
+	if s.tagFormat&InfluxLine != 0 {
+		return appendInfluxTail(data, rate, clockOrSystem(s.clock).Now())
 	}
 
+	data = append(data, kind.suffix()...)
+
 	if rate < 1 {
 		data = append(data, "|@"...)
-		data = strconv.AppendFloat(data, float64(rate), 'f', 6, 32)
+		data = appendRate(data, rate)
 	}
+	return data
+}
 
-	// suffix tags if present
-	if !skiptags && s.tagFormat&AllSuffix != 0 {
-		data = s.tagFormat.WriteSuffix(data, tags)
+// appendRate appends a sample rate to data, with 6 decimals, or as many as
+// needed for a rate below 0.000001, which could round to 0.
+func appendRate(data []byte, rate float32) []byte {
+	if rate < 0.000001 {
+		return strconv.AppendFloat(data, float64(rate), 'f', -1, 32)
 	}
+	return strconv.AppendFloat(data, float64(rate), 'f', 6, 32)
+}
 
-	_, err := s.sender.Send(data)
-	return err
+// appendSuffixTags appends suffix tags to data, if the tag format uses them
+func (s *clientState) appendSuffixTags(data []byte, tags []Tag) []byte {
+	// if infix tags were used, no suffix also.
+	if len(tags) == 0 || s.tagFormat&(AllInfix|InfluxLine) != 0 || s.tagFormat&AllSuffix == 0 {
+		return data
+	}
+	return s.tagFormat.WriteSuffix(data, tags)
 }
 
-// check for nil client, and perform sampling calculation
-func (s *Client) includeStat(rate float32) bool {
+// check for nil client, apply filters, and perform sampling calculation.
+// returns the current settings, the rate to encode in the stat, and whether
+// to send it.
+func (s *Client) includeStat(stat string, rate float32, tags []Tag) (*clientState, float32, bool) {
 	if s == nil {
-		return false
+		return nil, rate, false
 	}
 
 	// test for nil in case someone builds their own
-	// client without calling new (result is nil sampler)
-	if s.sampler != nil {
-		return s.sampler(rate)
+	// client without calling new (result is nil settings)
+	st := s.load()
+	if st == nil || s.isClosed() {
+		return nil, rate, false
+	}
+
+	if st.filter != nil {
+		d := st.filter.check(st.prefix, stat)
+		if d.deny {
+			return nil, rate, false
+		}
+		if d.rate > 0 {
+			rate = d.rate
+		}
+	}
+
+	var ok bool
+	switch {
+	case st.sampler == nil:
+		ok = DefaultSampler(rate)
+	case len(tags) == 0 && len(st.tags) == 0:
+		rate, ok = st.sampler(st.samplerNames.get(st.prefix, stat), rate, nil)
+	default:
+		// Passing tags to an arbitrary function would make them escape,
+		// forcing every caller's variadic tags to the heap. Hand the sampler
+		// a pooled copy instead (samplers must not retain it).
+		tp := tagsPool.Get().(*[]Tag)
+		*tp = append(append((*tp)[:0], st.tags...), tags...)
+		rate, ok = st.sampler(st.samplerNames.get(st.prefix, stat), rate, *tp)
+		tagsPool.Put(tp)
 	}
-	return DefaultSampler(rate)
+	// a stat with a rate of 0 is never sent, whatever the sampler decided,
+	// as the rate could not be written
+	return st, rate, ok && rate > 0
 }
 
 // SetPrefix sets/updates the statsd client prefix.
-// Note: Does not change the prefix of any SubStatters.
+// It is safe to call concurrently with sending stats.
+// Note: Does not change the prefix of any SubStatters, except for live ones
+// (see SubStatterConfig.Live). For a live SubStatter, prefix replaces the
+// component appended to the prefix of its parent.
 func (s *Client) SetPrefix(prefix string) {
 	if s == nil {
 		return
 	}
 
-	s.prefix = prefix
+	s.update(func(st *clientState) {
+		st.prefix = prefix
+	})
+}
+
+// Prefix returns the current statsd client prefix. For a SubStatter, this
+// is the full prefix, including that of its parent.
+func (s *Client) Prefix() string {
+	if s == nil {
+		return ""
+	}
+
+	st := s.load()
+	if st == nil {
+		return ""
+	}
+	return st.prefix
+}
+
+// Parent returns the Client or SubStatter a SubStatter was created from, or
+// nil for a Client.
+func (s *Client) Parent() SubStatter {
+	if s == nil || s.parent == nil {
+		return nil
+	}
+	return s.parent
+}
+
+// SubStatterConfig holds the settings of a SubStatter, see
+// Client.NewSubStatterWithConfig.
+type SubStatterConfig struct {
+	// Prefix is appended to the prefix of the parent. Can be "" if no
+	// additional prefix is desired.
+	Prefix string
+
+	// Tags are added to every stat sent with the SubStatter (following those
+	// of the parent, if any), ahead of the tags of the stat itself.
+	Tags []Tag
+
+	// Live determines whether the SubStatter follows later changes to the
+	// settings of its parent (eg. SetPrefix, SetSamplerFunc or Reconfigure).
+	// If false (the default), the settings of the parent are copied when the
+	// SubStatter is created.
+	// A live SubStatter keeps following the sampler of its parent until its
+	// own sampler is set.
+	Live bool
 }
 
 // NewSubStatter returns a SubStatter with appended prefix
 func (s *Client) NewSubStatter(prefix string) SubStatter {
+	return s.NewSubStatterWithConfig(&SubStatterConfig{Prefix: prefix})
+}
+
+// NewSubStatterWithConfig returns a SubStatter configured by config.
+//
+// A SubStatter shares the sender of its parent. Closing a SubStatter does
+// not close the sender, so SubStatters may be created and closed as needed
+// while the parent is in use. The parent does not keep track of its
+// SubStatters, so a SubStatter that is no longer used need not be closed.
+func (s *Client) NewSubStatterWithConfig(config *SubStatterConfig) ExtendedSubStatter {
 	var c *Client
-	if s != nil {
-		c = &Client{
-			prefix:    joinPathComp(s.prefix, prefix),
-			sender:    s.sender,
-			sampler:   s.sampler,
-			tagFormat: s.tagFormat,
-		}
+	if s == nil {
+		return c
+	}
+
+	if config == nil {
+		config = &SubStatterConfig{}
 	}
+
+	var st clientState
+	if config.Live {
+		st.prefix = config.Prefix
+		st.tags = joinTags(nil, config.Tags)
+	} else if cur := s.load(); cur != nil {
+		st = *cur
+		st.prefix = joinPathComp(st.prefix, config.Prefix)
+		st.tags = joinTags(st.tags, config.Tags)
+		st.ownSampler = false
+	}
+
+	c = newClient(&st)
+	c.parent = s
+	c.live = config.Live
 	return c
 }
 
+// joinTags returns a new slice holding tags followed by more, or tags if more
+// is empty.
+func joinTags(tags, more []Tag) []Tag {
+	if len(more) == 0 {
+		return tags
+	}
+	joined := make([]Tag, 0, len(tags)+len(more))
+	joined = append(joined, tags...)
+	return append(joined, more...)
+}
+
 // joinPathComp is a helper that ensures we combine path components with a dot
 // when it's appropriate to do so; prefix is the existing prefix and suffix is
 // the new component being added.
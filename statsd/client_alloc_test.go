@@ -0,0 +1,94 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientZeroAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful with the race detector")
+	}
+	for _, tf := range []TagFormat{SuffixOctothorpe, InfixComma, InfixSemicolon, InfluxLine} {
+		st, err := NewClientWithSender(&mockSender{}, "test", tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := st.(*Client)
+		counter := c.CounterHandle("count", Tag{"tag1", "val1"})
+		gauge := c.GaugeHandle("gauge", Tag{"tag1", "val1"})
+		timing := c.TimingHandle("timing", Tag{"tag1", "val1"})
+		sub := c.NewSubStatterWithConfig(&SubStatterConfig{
+			Prefix: "sub",
+			Tags:   []Tag{{"sub", "val"}},
+			Live:   true,
+		}).(*Client)
+
+		// each method is called directly on the *Client (rather than through
+		// an interface), so that the variadic tags may stay on the stack.
+		allocTests := []struct {
+			Method string
+			Func   func()
+		}{
+			{"Inc", func() { c.Inc("count", 1, 1) }},
+			{"Inc tags", func() { c.Inc("count", 1, 1, Tag{"tag1", "val1"}, Tag{"tag2", "val2"}) }},
+			{"Dec", func() { c.Dec("count", 1, 1) }},
+			{"Dec tags", func() { c.Dec("count", 1, 1, Tag{"tag1", "val1"}) }},
+			{"Gauge", func() { c.Gauge("gauge", 1, 1) }},
+			{"Gauge tags", func() { c.Gauge("gauge", 1, 1, Tag{"tag1", "val1"}) }},
+			{"GaugeDelta", func() { c.GaugeDelta("gauge", -1, 1) }},
+			{"GaugeDelta tags", func() { c.GaugeDelta("gauge", 1, 1, Tag{"tag1", "val1"}) }},
+			{"GaugeFloat", func() { c.GaugeFloat("gauge", 1.5, 1) }},
+			{"GaugeFloat tags", func() { c.GaugeFloat("gauge", 1.5, 1, Tag{"tag1", "val1"}) }},
+			{"GaugeFloatDelta", func() { c.GaugeFloatDelta("gauge", -1.5, 1) }},
+			{"GaugeFloatDelta tags", func() { c.GaugeFloatDelta("gauge", 1.5, 1, Tag{"tag1", "val1"}) }},
+			{"Timing", func() { c.Timing("timing", 1, 1) }},
+			{"Timing tags", func() { c.Timing("timing", 1, 1, Tag{"tag1", "val1"}) }},
+			{"TimingDuration", func() { c.TimingDuration("timing", time.Millisecond, 1) }},
+			{"TimingDuration tags", func() { c.TimingDuration("timing", time.Millisecond, 1, Tag{"tag1", "val1"}) }},
+			{"Set", func() { c.Set("set", "member", 1) }},
+			{"Set tags", func() { c.Set("set", "member", 1, Tag{"tag1", "val1"}) }},
+			{"SetInt", func() { c.SetInt("set", 1, 1) }},
+			{"SetInt tags", func() { c.SetInt("set", 1, 1, Tag{"tag1", "val1"}) }},
+			{"SetFloat", func() { c.SetFloat("set", 1.5, 1) }},
+			{"SetFloat tags", func() { c.SetFloat("set", 1.5, 1, Tag{"tag1", "val1"}) }},
+			{"Raw", func() { c.Raw("raw", "1.5", 1) }},
+			{"Raw tags", func() { c.Raw("raw", "1.5", 1, Tag{"tag1", "val1"}) }},
+			{"Inc sampled", func() { c.Inc("count", 1, 0.5, Tag{"tag1", "val1"}) }},
+			{"CounterHandle", func() { counter.Inc(1) }},
+			{"GaugeHandle", func() { gauge.GaugeFloatDelta(-1.5) }},
+			{"TimingHandle", func() { timing.TimingDuration(time.Millisecond) }},
+			{"SubStatter Inc tags", func() { sub.Inc("count", 1, 1, Tag{"tag1", "val1"}) }},
+		}
+
+		for _, tt := range allocTests {
+			// warm the buffer pool
+			tt.Func()
+			if n := testing.AllocsPerRun(100, tt.Func); n != 0 {
+				t.Errorf("format %d: %s: got %v allocs, expected 0", tf, tt.Method, n)
+			}
+		}
+	}
+}
+
+func TestClientZeroAllocsSampler(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful with the race detector")
+	}
+	st, err := NewClientWithSender(&mockSender{}, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := st.(*Client)
+	c.SetStatSamplerFunc(NewKeySampler("request_id"))
+
+	f := func() { c.Inc("count", 1, 0.5, Tag{"request_id", "abc"}) }
+	f()
+	if n := testing.AllocsPerRun(100, f); n != 0 {
+		t.Errorf("got %v allocs, expected 0", n)
+	}
+}
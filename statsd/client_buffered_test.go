@@ -65,13 +65,17 @@ func TestBufferedClientFlushTime(t *testing.T) {
 	defer l.Close()
 
 	for _, tt := range statsdPacketTests {
-		// set flush length to the size of the expected output packet
-		// so we can ensure a flush happens right away.
-		// set flush time sufficiently high so that it never matters for this
-		// test
-		c, err := NewBufferedClient(l.LocalAddr().String(), tt.Prefix, 1*time.Microsecond, 1024)
+		// flushes only happen when the clock ticks
+		clock := newManualClock()
+		c, err := NewClientWithConfig(&ClientConfig{
+			Address:       l.LocalAddr().String(),
+			Prefix:        tt.Prefix,
+			UseBuffered:   true,
+			FlushInterval: time.Second,
+			FlushBytes:    1024,
+			Clock:         clock,
+		})
 		if err != nil {
-			c.Close()
 			t.Fatal(err)
 		}
 		method := reflect.ValueOf(c).MethodByName(tt.Method)
@@ -85,7 +89,7 @@ func TestBufferedClientFlushTime(t *testing.T) {
 			t.Fatal(errInter.(error))
 		}
 
-		time.Sleep(1 * time.Millisecond)
+		clock.tick()
 
 		data := make([]byte, len(tt.Expected)+16)
 		_, _, err = l.ReadFrom(data)
@@ -109,7 +113,15 @@ func TestBufferedClientBigPacket(t *testing.T) {
 	}
 	defer l.Close()
 
-	c, err := NewBufferedClient(l.LocalAddr().String(), "test", 10*time.Millisecond, 1024)
+	clock := newManualClock()
+	c, err := NewClientWithConfig(&ClientConfig{
+		Address:       l.LocalAddr().String(),
+		Prefix:        "test",
+		UseBuffered:   true,
+		FlushInterval: time.Second,
+		FlushBytes:    1024,
+		Clock:         clock,
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -140,7 +152,7 @@ func TestBufferedClientBigPacket(t *testing.T) {
 
 	expected = strings.TrimSuffix(expected, "\n")
 
-	time.Sleep(12 * time.Millisecond)
+	clock.tick()
 	data := make([]byte, 1024)
 	_, _, err = l.ReadFrom(data)
 	if err != nil {
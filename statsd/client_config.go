@@ -43,28 +43,141 @@ type ClientConfig struct {
 	FlushBytes int
 
 	// The desired tag format to use for tags (note: statsd tag support varies)
-	// Supported formats are one of: statsd.DataDog, statsd.Grahpite, statsd.Influx
+	// Supported formats are one of: statsd.SuffixOctothorpe,
+	// statsd.InfixSemicolon, statsd.InfixComma.
+	// statsd.InfluxLine may be used to emit InfluxDB line protocol instead
+	// of statsd lines, eg. for a Telegraf socket_listener or an InfluxDB udp
+	// listener.
 	TagFormat TagFormat
+
+	// Sanitize determines how stat names, tag keys and tag values containing
+	// characters reserved by the TagFormat (eg. ':', '|', or a newline) are
+	// handled. They may be replaced or rejected. The default (SanitizeNone)
+	// writes them verbatim, which may corrupt the line or inject extra stats.
+	// Clean input is written without any additional allocations.
+	Sanitize SanitizeMode
+
+	// Validator, if set, is run on the full (prefixed) name of every stat
+	// before it is sent. CheckName may be used here.
+	Validator ValidatorFunc
+
+	// ValidatorPolicy determines what happens to stats failing validation.
+	// The default is to return the validation error.
+	ValidatorPolicy ValidatorPolicy
+
+	// ValidatorCacheSize is the number of stat names whose validation result
+	// is cached, so that repeated names are only validated once. If 0, results
+	// are not cached.
+	ValidatorCacheSize int
+
+	// TagCardinalityLimit is the maximum number of distinct tag combinations
+	// sent for each full stat name. Stats for further combinations are
+	// handled according to TagCardinalityPolicy, and counted with a
+	// CardinalityLimitedStat counter. If 0, tag cardinality is not limited.
+	// SubStatters share the limit state of their parent.
+	TagCardinalityLimit int
+
+	// TagCardinalityPolicy determines whether stats exceeding
+	// TagCardinalityLimit are dropped (the default), or have their new tag
+	// values collapsed to TagCardinalityPlaceholder.
+	TagCardinalityPolicy CardinalityPolicy
+
+	// TagCardinalityPlaceholder is the tag value used when collapsing.
+	// If empty, defaults to "other".
+	TagCardinalityPlaceholder string
+
+	// TagCardinalityNames is the maximum number of full stat names whose
+	// tag combinations are tracked. When reached, all tracked combinations
+	// are forgotten, keeping memory bounded. If 0, defaults to 10000.
+	TagCardinalityNames int
+
+	// Sampler is the sampler function used to decide whether a stat with a
+	// rate below 1 is sent. If nil, DefaultSampler is used.
+	// See also NewKeySampler, NewFastSampler and NewSeededSampler.
+	Sampler StatSamplerFunc
+
+	// RateSampler, if set, is used instead of Sampler. It may lower the rate
+	// actually used, as AdaptiveSampler.Sample does.
+	RateSampler RateSamplerFunc
+
+	// Middleware wraps the sender (simple, resolving or buffered, as
+	// configured) in order: the first SenderMiddleware wraps the sender, the
+	// second wraps the result, and so on. With a buffered sender, the
+	// middleware sees single stats, before they are buffered.
+	// See RateLimitMiddleware, LogMiddleware and SendCounter.
+	Middleware []SenderMiddleware
+
+	// MetricHooks are run in order on every stat sent, before it is
+	// formatted. See MetricHook.
+	MetricHooks []MetricHook
+
+	// Filters are matched in order against the full (prefixed) name of every
+	// stat, before it is sampled. The first matching rule determines whether
+	// the stat is sent, and may override its sample rate. Stats matching no
+	// rule are handled according to FilterDefault (sent, by default).
+	// Decisions are cached by name.
+	Filters []FilterRule
+
+	// FilterDefault determines whether stats matching no rule in Filters are
+	// sent.
+	FilterDefault FilterAction
+
+	// FilterCacheSize is the number of names whose filter decision is
+	// cached. If 0, defaults to 1024.
+	FilterCacheSize int
+
+	// RenameRules rename full (prefixed) stat names, optionally moving parts
+	// of the names into tags (which are then written according to
+	// TagFormat). The first matching rule is applied, before sanitizing and
+	// validation. Renames are cached by name.
+	RenameRules []RenameRule
+
+	// RenameCacheSize is the number of names whose rename is cached.
+	// If 0, defaults to 1024.
+	RenameCacheSize int
+
+	// Clock, if set, is used by the buffered sender to schedule flushes, by
+	// the resolving sender to schedule re-resolving, and for InfluxLine
+	// timestamps, instead of the system clock. It is meant for tests, see
+	// statsdtest.FakeClock. Clocks are compared by Reconfigure, so the Clock
+	// must be of a comparable type, such as a pointer.
+	Clock Clock
 }
 
 // NewClientWithConfig returns a new BufferedClient
 //
 // config is a ClientConfig, which holds various configuration values.
 func NewClientWithConfig(config *ClientConfig) (Statter, error) {
-	var sender Sender
-	var err error
-
 	// guard against nil config
 	if config == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
+	st, err := newClientState(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := newSender(config)
+	if err != nil {
+		return nil, err
+	}
+
+	st.sender = newSharedSender(sender, newSenderConfig(config))
+	return newClient(st), nil
+}
+
+// newSender returns a new Sender, as configured by config.
+func newSender(config *ClientConfig) (Sender, error) {
+	var sender Sender
+	var err error
+
 	// Use a re-resolving simple sender iff:
 	// *  The time duration greater than 0
 	// *  The Address is not an ip (eg. {ip}:{port}).
 	// Otherwise, re-resolution is not required.
 	if config.ResInterval > 0 && !mustBeIP(config.Address) {
-		sender, err = NewResolvingSimpleSender(config.Address, config.ResInterval)
+		sender, err = newResolvingSimpleSender(config.Address, config.ResInterval, config.Clock)
 	} else {
 		sender, err = NewSimpleSender(config.Address)
 	}
@@ -73,13 +186,19 @@ func NewClientWithConfig(config *ClientConfig) (Statter, error) {
 	}
 
 	if config.UseBuffered {
-		return newBufferedC(sender, config)
-	} else {
-		return NewClientWithSender(sender, config.Prefix, config.TagFormat)
+		sender, err = newBufferedS(sender, config)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	for _, mw := range config.Middleware {
+		sender = mw(sender)
+	}
+	return sender, nil
 }
 
-func newBufferedC(baseSender Sender, config *ClientConfig) (Statter, error) {
+func newBufferedS(baseSender Sender, config *ClientConfig) (Sender, error) {
 
 	flushBytes := config.FlushBytes
 	if flushBytes <= 0 {
@@ -93,12 +212,28 @@ func newBufferedC(baseSender Sender, config *ClientConfig) (Statter, error) {
 		flushInterval = 300 * time.Millisecond
 	}
 
-	bufsender, err := NewBufferedSenderWithSender(baseSender, flushInterval, flushBytes)
-	if err != nil {
-		return nil, err
-	}
+	return newBufferedSender(baseSender, flushInterval, flushBytes, config.Clock)
+}
+
+// senderConfig holds the ClientConfig values a Sender is built from.
+type senderConfig struct {
+	address       string
+	resInterval   time.Duration
+	useBuffered   bool
+	flushInterval time.Duration
+	flushBytes    int
+	clock         Clock
+}
 
-	return NewClientWithSender(bufsender, config.Prefix, config.TagFormat)
+func newSenderConfig(config *ClientConfig) senderConfig {
+	return senderConfig{
+		address:       config.Address,
+		resInterval:   config.ResInterval,
+		useBuffered:   config.UseBuffered,
+		flushInterval: config.FlushInterval,
+		flushBytes:    config.FlushBytes,
+		clock:         config.Clock,
+	}
 }
 
 // NewClientWithSender returns a pointer to a new Client and an error.
@@ -110,23 +245,134 @@ func newBufferedC(baseSender Sender, config *ClientConfig) (Statter, error) {
 // tagFormat is the desired tag format, if any. If you don't plan on using
 // tags, use 0 to use the default.
 func NewClientWithSender(sender Sender, prefix string, tagFormat TagFormat) (Statter, error) {
+	return newClientFromConfig(sender, &ClientConfig{
+		Prefix:    prefix,
+		TagFormat: tagFormat,
+	})
+}
+
+// newClientFromConfig returns a new Client using sender, configured from the
+// non-sender related fields of config.
+func newClientFromConfig(sender Sender, config *ClientConfig) (Statter, error) {
 	if sender == nil {
 		return nil, fmt.Errorf("client sender may not be nil")
 	}
 
+	st, err := newClientState(config)
+	if err != nil {
+		return nil, err
+	}
+
+	st.sender = newSharedSender(sender, senderConfig{})
+	return newClient(st), nil
+}
+
+// newClientState returns client settings (except for the sender) from
+// config.
+func newClientState(config *ClientConfig) (*clientState, error) {
+	tagFormat := config.TagFormat
 	// if zero value is supplied, pick something as a default
 	if tagFormat == 0 {
 		tagFormat = SuffixOctothorpe
 	}
 
-	if tagFormat&(AllInfix|AllSuffix) == 0 {
+	if tagFormat&(AllInfix|AllSuffix|InfluxLine) == 0 {
 		return nil, fmt.Errorf("invalid tagFormat section")
 	}
 
-	client := &Client{
-		prefix:    prefix,
-		sender:    sender,
-		tagFormat: tagFormat,
+	sampler := config.RateSampler
+	if sampler == nil {
+		sampler = config.Sampler.rateSampler()
+	}
+
+	filter, err := newNameFilter(config.Filters, config.FilterDefault, config.FilterCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	renamer, err := newRenamer(config.RenameRules, config.RenameCacheSize)
+	if err != nil {
+		return nil, err
 	}
-	return client, nil
+
+	st := &clientState{
+		prefix:       config.Prefix,
+		sampler:      sampler,
+		tagFormat:    tagFormat,
+		samplerNames: newSamplerNames(),
+		sanitizer:    newSanitizer(config.Sanitize, tagFormat),
+		validator:    newNameValidator(config.Validator, config.ValidatorPolicy, config.ValidatorCacheSize),
+		limiter:      newCardinalityLimiter(config.TagCardinalityLimit, config.TagCardinalityPolicy, config.TagCardinalityPlaceholder, config.TagCardinalityNames),
+		hooks:        joinHooks(nil, config.MetricHooks),
+		filter:       filter,
+		renamer:      renamer,
+		clock:        config.Clock,
+	}
+	return st, nil
+}
+
+// Reconfigure atomically replaces the settings of the client with those from
+// config: prefix, tag format, sampler, filters, renames, sanitizing,
+// validation, tag cardinality limiting and metric hooks. It is safe to call
+// concurrently with sending stats.
+//
+// If the sender settings (Address, ResInterval, UseBuffered, FlushInterval,
+// FlushBytes and Clock) differ from those the current sender was built from,
+// a new sender is built and swapped in, and the old one is closed, flushing
+// any buffered stats. A stat sent concurrently with the swap may fail with
+// an error. Middleware is only applied to a new sender, so changing just the
+// Middleware does not rebuild the sender. For a client created with
+// NewClientWithSender, leave the sender settings other than Clock unset to
+// keep the supplied sender.
+//
+// SubStatters share the sender of their parent, so they switch to a new
+// sender as well. Their other settings are not changed, unless they are live
+// (see SubStatterConfig.Live). SubStatters themselves cannot be reconfigured.
+func (s *Client) Reconfigure(config *ClientConfig) error {
+	if s == nil {
+		return nil
+	}
+
+	// guard against nil config
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if s.parent != nil {
+		return fmt.Errorf("a SubStatter cannot be reconfigured")
+	}
+
+	st, err := newClientState(config)
+	if err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	cur := s.load()
+	if cur == nil {
+		return fmt.Errorf("client was not created with a constructor")
+	}
+
+	st.sender = cur.sender
+	box := st.sender.load()
+	sc := newSenderConfig(config)
+	if box.config == (senderConfig{}) && sc == (senderConfig{clock: sc.clock}) {
+		// a supplied sender does not use the Clock
+		sc.clock = nil
+	}
+	if sc == box.config {
+		s.state.Store(st)
+		return nil
+	}
+
+	sender, err := newSender(config)
+	if err != nil {
+		return err
+	}
+
+	st.sender.v.Store(&senderBox{sender, sc})
+	s.state.Store(st)
+	return box.Sender.Close()
 }
@@ -0,0 +1,195 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func readPacket(t *testing.T, l net.PacketConn) string {
+	t.Helper()
+	data := make([]byte, 128)
+	n, _, err := l.ReadFrom(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes.TrimRight(data[:n], "\n"))
+}
+
+func TestClientReconfigure(t *testing.T) {
+	l1, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+	l2, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+
+	c, err := NewClientWithConfig(&ClientConfig{
+		Address:       l1.LocalAddr().String(),
+		Prefix:        "one",
+		UseBuffered:   true,
+		FlushInterval: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sub := c.NewSubStatter("sub")
+
+	c.Inc("count", 1, 1)
+
+	err = c.(*Client).Reconfigure(&ClientConfig{
+		Address:   l2.LocalAddr().String(),
+		Prefix:    "two",
+		TagFormat: InfixComma,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the old buffered sender is drained on close
+	if got, want := readPacket(t, l1), "one.count:1|c"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+
+	c.Inc("count", 1, 1, Tag{"tag1", "val1"})
+	if got, want := readPacket(t, l2), "two.count,tag1=val1:1|c"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+
+	// SubStatters keep their settings, but follow the sender
+	sub.Inc("count", 1, 1)
+	if got, want := readPacket(t, l2), "one.sub.count:1|c"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+}
+
+func TestClientReconfigureKeepsSender(t *testing.T) {
+	cs := &captureSender{}
+	c, err := NewClientWithSender(cs, "one", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.(*Client).Reconfigure(&ClientConfig{Prefix: "two", Clock: newManualClock()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Inc("count", 1, 1)
+
+	got := cs.take()
+	if len(got) != 1 || got[0] != "two.count:1|c" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestClientReconfigureClock(t *testing.T) {
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	config := &ClientConfig{
+		Address:       l.LocalAddr().String(),
+		UseBuffered:   true,
+		FlushInterval: time.Second,
+	}
+	c, err := NewClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// only the Clock changes, which must reach the new buffered sender
+	clock := newManualClock()
+	config.Clock = clock
+	if err := c.(*Client).Reconfigure(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.(*Client).Reconfigure(config); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Inc("count", 1, 1)
+	clock.tick()
+	if got, want := readPacket(t, l), "count:1|c"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+}
+
+func TestClientReconfigureInvalid(t *testing.T) {
+	c, err := NewClientWithSender(&captureSender{}, "one", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.(*Client).Reconfigure(nil); err == nil {
+		t.Fatal("expected an error for a nil config")
+	}
+	if err := c.(*Client).Reconfigure(&ClientConfig{TagFormat: 1 << 7}); err == nil {
+		t.Fatal("expected an error for an invalid tag format")
+	}
+}
+
+// Run with -race to be meaningful.
+func TestClientConcurrentReconfigure(t *testing.T) {
+	cs := &captureSender{}
+	st, err := NewClientWithSender(cs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := st.(*Client)
+	h := c.CounterHandle("handle")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c.Inc("count", 1, 1, Tag{"tag1", "val1"})
+				c.TimingDuration("timing", time.Millisecond, 0.5)
+				h.Inc(1)
+				c.NewSubStatter("sub").Inc("count", 1, 1)
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		c.SetPrefix(fmt.Sprintf("prefix%d", i))
+		c.SetSamplerFunc(func(float32) bool { return true })
+		err := c.Reconfigure(&ClientConfig{
+			Prefix:    fmt.Sprintf("reconf%d", i),
+			TagFormat: InfixSemicolon,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	c.Inc("count", 1, 1)
+	sent := cs.take()
+	if got, want := sent[len(sent)-1], "reconf99.count:1|c"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+}
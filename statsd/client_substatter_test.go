@@ -263,3 +263,158 @@ func ExampleClient_substatter() {
 		log.Printf("Error sending metric: %+v", err)
 	}
 }
+
+func TestSubStatterTags(t *testing.T) {
+	cs := &captureSender{}
+	c, err := NewClientWithSender(cs, "test", InfixComma)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := c.(*Client).NewSubStatterWithConfig(&SubStatterConfig{
+		Prefix: "sub",
+		Tags:   []Tag{{"plugin", "one"}},
+	})
+	ss := s.(*Client).NewSubStatterWithConfig(&SubStatterConfig{
+		Tags: []Tag{{"inst", "a"}},
+	})
+
+	s.Inc("count", 1, 1)
+	ss.Inc("count", 1, 1, Tag{"tag1", "val1"})
+	ss.(*Client).CounterHandle("handle").Inc(1)
+	c.Inc("count", 1, 1)
+
+	expected := []string{
+		"test.sub.count,plugin=one:1|c",
+		"test.sub.count,plugin=one,inst=a,tag1=val1:1|c",
+		"test.sub.handle,plugin=one,inst=a:1|c",
+		"test.count:1|c",
+	}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+}
+
+func TestSubStatterLive(t *testing.T) {
+	cs := &captureSender{}
+	st, err := NewClientWithSender(cs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := st.(*Client)
+
+	fixed := c.NewSubStatter("fixed")
+	live := c.NewSubStatterWithConfig(&SubStatterConfig{Prefix: "live", Live: true})
+	sublive := live.NewSubStatterWithConfig(&SubStatterConfig{Prefix: "sub", Live: true})
+	h := sublive.(*Client).CounterHandle("handle")
+
+	c.SetPrefix("changed")
+	c.SetSamplerFunc(func(float32) bool { return false })
+
+	fixed.Inc("count", 1, 1)
+	live.Inc("count", 1, 1)
+	sublive.Inc("count", 1, 1)
+	h.Inc(1)
+	expected := []string{"test.fixed.count:1|c"}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+
+	// an own sampler is independent of the parent
+	live.SetSamplerFunc(func(float32) bool { return true })
+	live.Inc("count", 1, 1)
+	sublive.Inc("count", 1, 1)
+	h.Inc(1)
+	c.Inc("count", 1, 1)
+	expected = []string{
+		"changed.live.count:1|c",
+		"changed.live.sub.count:1|c",
+		"changed.live.sub.handle:1|c",
+	}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+
+	if got, want := sublive.Prefix(), "changed.live.sub"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+	live.(*Client).SetPrefix("other")
+	if got, want := sublive.Prefix(), "changed.other.sub"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+}
+
+func TestSubStatterParent(t *testing.T) {
+	c, err := NewClientWithSender(&captureSender{}, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.NewSubStatter("sub").(ExtendedSubStatter)
+	ss := s.NewSubStatter("subsub").(ExtendedSubStatter)
+
+	if p := c.(*Client).Parent(); p != nil {
+		t.Fatalf("expected no parent, got %v", p)
+	}
+	if ss.Parent() != s || s.Parent() != c.(*Client) {
+		t.Fatal("unexpected parent")
+	}
+	if got, want := ss.Prefix(), "test.sub.subsub"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+	if err := s.(*Client).Reconfigure(&ClientConfig{}); err == nil {
+		t.Fatal("expected an error reconfiguring a SubStatter")
+	}
+
+	var nc *Client
+	if nc.Parent() != nil || nc.Prefix() != "" {
+		t.Fatal("unexpected nil client behavior")
+	}
+}
+
+func TestSubStatterClose(t *testing.T) {
+	cs := &captureSender{}
+	sender, err := NewBufferedSenderWithSender(cs, time.Hour, 1432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClientWithSender(sender, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := c.NewSubStatter("sub").(ExtendedSubStatter)
+	ss := s.NewSubStatter("subsub")
+	s.Inc("count", 1, 1)
+
+	// closing flushes the shared sender, but leaves it open
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"test.sub.count:1|c"}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+
+	// stats sent with closed SubStatters are discarded
+	if err := s.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.(*Client).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"test.count:1|c"}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+}
@@ -7,6 +7,7 @@ package statsd
 import (
 	"bytes"
 	"log"
+	"math"
 	"net"
 	"reflect"
 	"testing"
@@ -159,7 +160,9 @@ func TestClientTags(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		c.(*Client).tagFormat = tt.TagFormat
+		c.(*Client).update(func(st *clientState) {
+			st.tagFormat = tt.TagFormat
+		})
 		method := reflect.ValueOf(c).MethodByName(tt.Method)
 		values := []reflect.Value{
 			reflect.ValueOf(tt.Stat),
@@ -190,6 +193,120 @@ func TestClientTags(t *testing.T) {
 	}
 }
 
+func TestClientInfluxLine(t *testing.T) {
+	influxPacketTests := []struct {
+		Prefix   string
+		Method   string
+		Stat     string
+		Value    interface{}
+		Rate     float32
+		Tags     []Tag
+		Expected string
+	}{
+		{"test", "Inc", "count", int64(1), 1.0, nil, "test.count count=1i"},
+		{"test", "Dec", "count", int64(1), 1.0, nil, "test.count count=-1i"},
+		{"test", "Inc", "count", int64(1), 0.5, nil, "test.count count=1i,sample_rate=0.500000"},
+		{"test", "Gauge", "gauge", int64(1), 1.0, nil, "test.gauge gauge=1"},
+		{"test", "GaugeDelta", "gauge", int64(1), 1.0, nil, "test.gauge gauge_delta=1"},
+		{"test", "GaugeDelta", "gauge", int64(-1), 1.0, nil, "test.gauge gauge_delta=-1"},
+		{"test", "GaugeFloat", "gauge", float64(1.5), 1.0, nil, "test.gauge gauge=1.5"},
+		{"test", "GaugeFloatDelta", "gauge", float64(-1.5), 1.0, nil, "test.gauge gauge_delta=-1.5"},
+		{"test", "Timing", "timing", int64(1), 1.0, nil, "test.timing timing=1"},
+		{"test", "TimingDuration", "timing", 1500 * time.Microsecond, 1.0, nil, "test.timing timing=1.5"},
+		{"test", "Set", "strset", `pic"kle`, 1.0, nil, `test.strset set="pic\"kle"`},
+		{"test", "SetInt", "intset", int64(1), 1.0, nil, `test.intset set="1"`},
+		{"test", "SetFloat", "floatset", float64(1.5), 1.0, nil, `test.floatset set="1.5"`},
+		{"test", "Raw", "raw", "1.5", 1.0, nil, "test.raw value=1.5"},
+		{"test", "Raw", "raw", "2", 1.0, nil, "test.raw value=2"},
+		{"", "Inc", "count", int64(1), 1.0, nil, "count count=1i"},
+		{
+			"test", "Inc", "count", int64(1), 1.0,
+			[]Tag{{"tag1", "val1"}, {"tag2", "val2"}},
+			"test.count,tag1=val1,tag2=val2 count=1i",
+		},
+		{
+			"te st", "Inc", "co,unt", int64(1), 1.0,
+			[]Tag{{"t=ag 1", "v,al=1"}},
+			`te\ st.co\,unt,t\=ag\ 1=v\,al\=1 count=1i`,
+		},
+		{
+			"test", "Inc", `co\unt\`, int64(1), 1.0,
+			[]Tag{{`tag\`, `val\`}},
+			`test.co\\unt\\,tag\\=val\\ count=1i`,
+		},
+		{
+			"test", "Inc", "count", int64(1), 1.0,
+			[]Tag{{"", "val1"}, {"tag2", ""}, {"tag3", "val3"}},
+			"test.count,tag3=val3 count=1i",
+		},
+	}
+
+	// every line ends with the timestamp of the clock, in nanoseconds
+	clock := &manualClock{now: time.Unix(1600000000, 5)}
+	const timestamp = " 1600000000000000005"
+
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, tt := range influxPacketTests {
+		config := &ClientConfig{
+			Address:   l.LocalAddr().String(),
+			Prefix:    tt.Prefix,
+			TagFormat: InfluxLine,
+			// send every stat, whatever its rate
+			Sampler: func(string, float32, []Tag) bool { return true },
+			Clock:   clock,
+		}
+
+		c, err := NewClientWithConfig(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		method := reflect.ValueOf(c).MethodByName(tt.Method)
+		values := []reflect.Value{
+			reflect.ValueOf(tt.Stat),
+			reflect.ValueOf(tt.Value),
+			reflect.ValueOf(tt.Rate)}
+		for _, tag := range tt.Tags {
+			values = append(values, reflect.ValueOf(tag))
+		}
+		e := method.Call(values)[0]
+		errInter := e.Interface()
+		if errInter != nil {
+			t.Fatal(errInter.(error))
+		}
+
+		data := make([]byte, 128)
+		_, _, err = l.ReadFrom(data)
+		if err != nil {
+			c.Close()
+			t.Fatal(err)
+		}
+
+		data = bytes.TrimRight(data, "\x00")
+		if !bytes.Equal(data, []byte(tt.Expected+timestamp)) {
+			c.Close()
+			t.Fatalf("%s got '%s' expected '%s'", tt.Method, data, tt.Expected+timestamp)
+		}
+		c.Close()
+	}
+}
+
+func TestClientInfluxLineErrors(t *testing.T) {
+	c, err := NewClientWithSender(&captureSender{}, "test", InfluxLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Raw("raw", "1|c", 1); err == nil {
+		t.Error("expected an error for a non numeric raw value")
+	}
+	if err := c.(*Client).GaugeFloat("gauge", math.NaN(), 1); err == nil {
+		t.Error("expected an error for a NaN value")
+	}
+}
+
 func TestNilClient(t *testing.T) {
 	l, err := newUDPListener("127.0.0.1:0")
 	if err != nil {
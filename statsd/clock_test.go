@@ -0,0 +1,89 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock whose time is set by the test, and whose single
+// ticker ticks on demand.
+type manualClock struct {
+	mx  sync.Mutex
+	now time.Time
+	c   chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(0, 0), c: make(chan time.Time)}
+}
+
+func (m *manualClock) Now() time.Time {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.now
+}
+
+func (m *manualClock) NewTicker(d time.Duration) Ticker {
+	return manualTicker{m.c}
+}
+
+func (m *manualClock) advance(d time.Duration) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.now = m.now.Add(d)
+}
+
+// tick blocks until the ticker's receiver takes the tick.
+func (m *manualClock) tick() {
+	m.c <- m.Now()
+}
+
+type manualTicker struct {
+	c chan time.Time
+}
+
+func (t manualTicker) C() <-chan time.Time { return t.c }
+func (t manualTicker) Stop()               {}
+
+func TestBufferedSenderClock(t *testing.T) {
+	cs := &captureSender{}
+	clock := newManualClock()
+	sender, err := newBufferedSender(cs, time.Hour, 512, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender.Send([]byte("stat:1|c"))
+	clock.tick()
+	// the second tick is only taken once the first one was handled
+	clock.tick()
+	sender.Send([]byte("stat:2|c"))
+	if err := sender.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the tick, both stats would have been sent in a single packet
+	if got := cs.take(); len(got) != 2 || got[0] != "stat:1|c" || got[1] != "stat:2|c" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestAdaptiveSamplerClock(t *testing.T) {
+	clock := newManualClock()
+	a := NewAdaptiveSamplerWithClock(100, time.Second, clock)
+
+	for i := 0; i < 1000; i++ {
+		a.Sample("busy", 1, nil)
+	}
+	clock.advance(time.Second)
+
+	// exactly 1000 lines in 1s, for a budget of 100 lines/s
+	if rate, _ := a.Sample("busy", 1, nil); rate != 0.1 {
+		t.Fatalf("expected a rate of 0.1, got %f", rate)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FilterAction determines whether a stat matching a FilterRule is sent.
+type FilterAction uint8
+
+const (
+	// FilterAllow sends matching stats.
+	FilterAllow FilterAction = iota
+	// FilterDeny drops matching stats.
+	FilterDeny
+)
+
+// defaultFilterCacheSize is the number of cached filter decisions, if not
+// configured.
+const defaultFilterCacheSize = 1024
+
+// FilterRule is a rule matching full (prefixed) stat names, see
+// ClientConfig.Filters.
+type FilterRule struct {
+	// Pattern is a glob, where '*' matches a single, non empty, name
+	// component (a sequence of characters other than dots), '**' matches any
+	// number of components, including none (so "a.**.b" also matches "a.b"),
+	// and '?' matches any single character other than a dot, or a regular
+	// expression if Regexp is set. Either must match the whole name.
+	// Globs have the same meaning in RenameRule.Pattern.
+	Pattern string
+	Regexp  bool
+
+	// Action determines whether matching stats are sent.
+	Action FilterAction
+
+	// Rate, if above 0, replaces the sample rate of matching stats that are
+	// sent, eg. to downsample a noisy stat.
+	Rate float32
+}
+
+// filterDecision is the (cached) result of filtering a stat name.
+type filterDecision struct {
+	deny bool
+	// sample rate override, 0 if none
+	rate float32
+}
+
+type filterRule struct {
+	re       *regexp.Regexp
+	decision filterDecision
+}
+
+// nameFilter applies FilterRules to full stat names, caching the decisions.
+type nameFilter struct {
+	rules []filterRule
+	// decision for names matching no rule
+	fallback filterDecision
+	// cache of decisions by name
+	cache *nameCache
+}
+
+// newNameFilter returns a nameFilter, or nil if there are no rules and all
+// stats are allowed.
+func newNameFilter(rules []FilterRule, fallback FilterAction, cacheSize int) (*nameFilter, error) {
+	if len(rules) == 0 && fallback == FilterAllow {
+		return nil, nil
+	}
+
+	if cacheSize <= 0 {
+		cacheSize = defaultFilterCacheSize
+	}
+
+	f := &nameFilter{
+		rules:    make([]filterRule, len(rules)),
+		fallback: filterDecision{deny: fallback == FilterDeny},
+		cache:    newNameCache(cacheSize),
+	}
+	for i, r := range rules {
+		pattern := r.Pattern
+		if !r.Regexp {
+			pattern = globToRegexp(pattern)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q: %s", r.Pattern, err)
+		}
+		f.rules[i] = filterRule{
+			re:       re,
+			decision: filterDecision{deny: r.Action == FilterDeny, rate: r.Rate},
+		}
+	}
+	return f, nil
+}
+
+// globToRegexp returns a regular expression equivalent to glob, see
+// FilterRule.Pattern. Each '*' and '**' is a capturing group. A '**' that is
+// a whole name component is optional along with one of its dots, so that it
+// may match no component at all, leaving its group unmatched.
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case i == 0 && strings.HasPrefix(glob, "**."):
+			re.WriteString(`(?:(.+)\.)?`)
+			i += 2
+		case strings.HasPrefix(glob[i:], ".**") && (i+3 == len(glob) || glob[i+3] == '.'):
+			re.WriteString(`(?:\.(.+))?`)
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(`(.+)`)
+			i++
+		case glob[i] == '*':
+			re.WriteString(`([^.]+)`)
+		case glob[i] == '?':
+			re.WriteString(`[^.]`)
+		default:
+			re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return re.String()
+}
+
+// check returns the decision for the stat prefix.stat.
+func (f *nameFilter) check(prefix, stat string) filterDecision {
+	if d, ok := f.cache.get(prefix, stat); ok {
+		return d.(filterDecision)
+	}
+
+	name := joinName(prefix, stat)
+	return f.cache.add(name, f.run(name)).(filterDecision)
+}
+
+// run returns the decision of the first rule matching name.
+func (f *nameFilter) run(name string) filterDecision {
+	for _, r := range f.rules {
+		if r.re.MatchString(name) {
+			return r.decision
+		}
+	}
+	return f.fallback
+}
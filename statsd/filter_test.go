@@ -0,0 +1,140 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNameFilter(t *testing.T) {
+	f, err := newNameFilter([]FilterRule{
+		{Pattern: "test.debug.*", Action: FilterDeny},
+		{Pattern: "test.trace.**", Action: FilterDeny},
+		{Pattern: "test.http.?xx", Rate: 0.5},
+		{Pattern: `test\.db\.(read|write)`, Regexp: true},
+		{Pattern: "test.db.*", Action: FilterDeny},
+		{Pattern: "**.tmp.**", Action: FilterDeny},
+	}, FilterAllow, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filterTests := []struct {
+		Prefix   string
+		Stat     string
+		Expected filterDecision
+	}{
+		{"test", "debug.count", filterDecision{deny: true}},
+		{"test.debug", "count", filterDecision{deny: true}},
+		{"test", "debugcount", filterDecision{}},
+		{"test", "debug.sub.count", filterDecision{}},
+		{"test", "trace.count", filterDecision{deny: true}},
+		{"test", "trace.sub.count", filterDecision{deny: true}},
+		{"test", "trace", filterDecision{deny: true}},
+		{"test", "tracer", filterDecision{}},
+		{"test", "http.2xx", filterDecision{rate: 0.5}},
+		{"test", "http.5xx", filterDecision{rate: 0.5}},
+		{"test", "http.200", filterDecision{}},
+		{"test", "http.2000", filterDecision{}},
+		{"test", "http..xx", filterDecision{}},
+		{"test", "db.read", filterDecision{}},
+		{"test", "db.other", filterDecision{deny: true}},
+		{"test", "db.read.count", filterDecision{}},
+		{"", "db.other", filterDecision{}},
+		{"", "tmp", filterDecision{deny: true}},
+		{"test", "tmp.count", filterDecision{deny: true}},
+		{"test", "cache.tmp", filterDecision{deny: true}},
+		{"test", "cache.tmp.count", filterDecision{deny: true}},
+		{"test", "cache.tmpdir", filterDecision{}},
+	}
+
+	// twice, to exercise the cache
+	for i := 0; i < 2; i++ {
+		for _, tt := range filterTests {
+			if got := f.check(tt.Prefix, tt.Stat); got != tt.Expected {
+				t.Fatalf("%s.%s: got %+v expected %+v", tt.Prefix, tt.Stat, got, tt.Expected)
+			}
+		}
+	}
+	if len(f.cache.m) > 2 {
+		t.Fatalf("cache exceeded its bound: %d", len(f.cache.m))
+	}
+}
+
+func TestNameFilterInvalid(t *testing.T) {
+	_, err := newNameFilter([]FilterRule{{Pattern: "(", Regexp: true}}, FilterAllow, 0)
+	if err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+	if f, _ := newNameFilter(nil, FilterAllow, 0); f != nil {
+		t.Fatal("expected no filter without rules")
+	}
+}
+
+func TestClientFilters(t *testing.T) {
+	cs := &captureSender{}
+	st, err := NewClientWithSender(cs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := st.(*Client)
+	err = c.Reconfigure(&ClientConfig{
+		Prefix: "test",
+		Filters: []FilterRule{
+			{Pattern: "test.count"},
+			{Pattern: "test.sampled", Rate: 0.999999},
+			{Pattern: "test.sub.*"},
+		},
+		FilterDefault: FilterDeny,
+		Sampler:       func(string, float32, []Tag) bool { return true },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Inc("count", 1, 1)
+	c.Inc("other", 1, 1)
+	c.Inc("sampled", 1, 1)
+	c.CounterHandle("sampled").Inc(1)
+	c.NewSubStatter("sub").Inc("count", 1, 1)
+	c.NewSubStatter("other").Inc("count", 1, 1)
+
+	expected := []string{
+		"test.count:1|c",
+		"test.sampled:1|c|@0.999999",
+		"test.sampled:1|c|@0.999999",
+		"test.sub.count:1|c",
+	}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+}
+
+func TestClientFiltersZeroAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful with the race detector")
+	}
+	c, err := NewClientWithSender(&mockSender{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := c.(*Client)
+	err = cl.Reconfigure(&ClientConfig{
+		Prefix:  "test",
+		Filters: []FilterRule{{Pattern: "test.debug.*", Action: FilterDeny}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stat := range []string{"count", "debug.count"} {
+		f := func() { cl.Inc(stat, 1, 1, Tag{"tag1", "val1"}) }
+		f()
+		if n := testing.AllocsPerRun(100, f); n != 0 {
+			t.Errorf("%s: got %v allocs, expected 0", stat, n)
+		}
+	}
+}
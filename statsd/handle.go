@@ -0,0 +1,355 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The HandleStatter interface defines the creation of stat handles, see
+// Client.CounterHandle. It is implemented by Clients, MultiStatters and their
+// SubStatters. Callers may type assert a Statter or SubStatter to it.
+type HandleStatter interface {
+	CounterHandle(stat string, tags ...Tag) *CounterHandle
+	GaugeHandle(stat string, tags ...Tag) *GaugeHandle
+	TimingHandle(stat string, tags ...Tag) *TimingHandle
+}
+
+// boundStat is the pre-rendered form of a stat.
+type boundStat struct {
+	// client settings at render time; the render is stale once they change
+	state *clientState
+	// name and infix tags (or line protocol measurement and tags)
+	head []byte
+	// suffix tags
+	tagTail []byte
+	// whether the stat is not to be sent, and why, if it was rejected
+	drop bool
+	err  error
+}
+
+// handle is the implementation shared by the typed handles.
+type handle struct {
+	c    *Client
+	stat string
+	tags []Tag
+	kind statType
+	rate float32
+	// current *boundStat
+	bound atomic.Value
+	// for a MultiStatter handle: the handles of its Statters
+	multi []*handle
+	// error returned on every send, for a Statter not supporting handles
+	err error
+}
+
+func newHandle(c *Client, stat string, kind statType, rate float32, tags []Tag) *handle {
+	h := &handle{
+		c:    c,
+		stat: stat,
+		kind: kind,
+		rate: rate,
+	}
+	if len(tags) != 0 {
+		// copy, as the caller may reuse the variadic slice
+		h.tags = make([]Tag, len(tags))
+		copy(h.tags, tags)
+	}
+	return h
+}
+
+// withRate returns a copy of h using rate.
+func (h *handle) withRate(rate float32) *handle {
+	nh := &handle{
+		c:    h.c,
+		stat: h.stat,
+		tags: h.tags,
+		kind: h.kind,
+		rate: rate,
+		err:  h.err,
+	}
+	if b := h.bound.Load(); b != nil {
+		nh.bound.Store(b)
+	}
+	for _, p := range h.multi {
+		nh.multi = append(nh.multi, p.withRate(rate))
+	}
+	return nh
+}
+
+// load returns the render for the settings st, rendering it if needed.
+func (h *handle) load(st *clientState) *boundStat {
+	b, _ := h.bound.Load().(*boundStat)
+	if b == nil || b.state != st {
+		// concurrent renders are identical, so a racing store is harmless
+		b = st.bind(h.stat, h.kind, h.tags)
+		h.bound.Store(b)
+	}
+	return b
+}
+
+// each calls fn with the handles of a MultiStatter handle, joining the
+// errors.
+func (h *handle) each(fn func(*handle) error) error {
+	var errs []error
+	for _, p := range h.multi {
+		if err := fn(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return JoinErrors(errs)
+}
+
+// sendInt sends an integer value.
+func (h *handle) sendInt(vprefix string, v int64) error {
+	if h.multi != nil {
+		return h.each(func(p *handle) error { return p.sendInt(vprefix, v) })
+	}
+	if h.err != nil {
+		return h.err
+	}
+
+	st, rate, ok := h.c.includeStat(h.stat, h.rate, h.tags)
+	if !ok {
+		return nil
+	}
+	if len(st.hooks) != 0 {
+		// hooks see every stat before it is formatted
+		return st.submitInt(h.stat, vprefix, v, h.kind, rate, h.tags)
+	}
+
+	b := h.load(st)
+	if b.drop {
+		return b.err
+	}
+
+	buf := bufPool.Get()
+	defer bufPool.Put(buf)
+	data := append(buf.Bytes(), b.head...)
+	data = st.appendInt(data, vprefix, v, h.kind)
+	return h.send(st, data, rate, b)
+}
+
+// sendFloat sends a float value.
+func (h *handle) sendFloat(vprefix string, v float64) error {
+	if h.multi != nil {
+		return h.each(func(p *handle) error { return p.sendFloat(vprefix, v) })
+	}
+	if h.err != nil {
+		return h.err
+	}
+
+	st, rate, ok := h.c.includeStat(h.stat, h.rate, h.tags)
+	if !ok {
+		return nil
+	}
+	if len(st.hooks) != 0 {
+		// hooks see every stat before it is formatted
+		return st.submitFloat(h.stat, vprefix, v, h.kind, rate, h.tags)
+	}
+
+	b := h.load(st)
+	if b.drop {
+		return b.err
+	}
+
+	buf := bufPool.Get()
+	defer bufPool.Put(buf)
+	data := append(buf.Bytes(), b.head...)
+	data, err := st.appendFloat(data, vprefix, v, h.kind)
+	if err != nil {
+		return err
+	}
+	return h.send(st, data, rate, b)
+}
+
+// send completes the stat in data and sends it.
+func (h *handle) send(st *clientState, data []byte, rate float32, b *boundStat) error {
+	data = st.appendTail(data, h.kind, rate)
+	data = append(data, b.tagTail...)
+	_, err := st.sender.load().Send(data)
+	return err
+}
+
+// bind renders a stat for use by a handle.
+func (s *clientState) bind(stat string, kind statType, tags []Tag) *boundStat {
+	b := &boundStat{state: s}
+
+	buf := bufPool.Get()
+	defer bufPool.Put(buf)
+
+	prefix, stat, tags, tp := s.rename(s.prefix, stat, joinTags(s.tags, tags))
+	if tp != nil {
+		defer tagsPool.Put(tp)
+	}
+
+	prefix, stat, tags, ok, err := s.prepare(buf.Bytes(), prefix, stat, tags)
+	if !ok {
+		b.drop = true
+		b.err = err
+		return b
+	}
+
+	b.head = s.appendHead(nil, prefix, stat, kind, tags)
+	b.tagTail = s.appendSuffixTags(nil, tags)
+	return b
+}
+
+// CounterHandle is a counter bound to a stat name and tags.
+// See Client.CounterHandle.
+type CounterHandle struct {
+	h *handle
+}
+
+// CounterHandle returns a CounterHandle for stat and tags, sending with a
+// sample rate of 1 (see CounterHandle.WithRate).
+//
+// Handles are stats bound to a name and tags up front, for use in hot code
+// paths. The prefixed name, tags and type are rendered once, so sending only
+// appends the value (and sample rate, if any).
+//
+// Sanitizing, validation and tag cardinality limiting are applied when the
+// handle is first used (and again if the Client prefix changes), instead of
+// on every send. Sampling is applied on every send.
+//
+// Handles remain valid after SetPrefix (or Reconfigure), picking up the new
+// settings. While the Client has MetricHooks, handles send like the Client
+// methods do, without pre-rendering.
+// Handles bound to a nil *Client are safe to use, and have noop behavior.
+//
+// The constructors are named after the handle types, as Client.Gauge and
+// Client.Timing already send stats. See HandleStatter for the SubStatters
+// and MultiStatters also creating handles.
+func (s *Client) CounterHandle(stat string, tags ...Tag) *CounterHandle {
+	return &CounterHandle{newHandle(s, stat, statCount, 1, tags)}
+}
+
+// WithRate returns a copy of the handle, sending with the sample rate rate.
+func (c *CounterHandle) WithRate(rate float32) *CounterHandle {
+	if c == nil {
+		return nil
+	}
+	return &CounterHandle{c.h.withRate(rate)}
+}
+
+// Inc increments the counter by value.
+func (c *CounterHandle) Inc(value int64) error {
+	if c == nil {
+		return nil
+	}
+	return c.h.sendInt("", value)
+}
+
+// Dec decrements the counter by value.
+func (c *CounterHandle) Dec(value int64) error {
+	if c == nil {
+		return nil
+	}
+	return c.h.sendInt("", -value)
+}
+
+// GaugeHandle is a gauge bound to a stat name and tags.
+// See Client.GaugeHandle.
+type GaugeHandle struct {
+	h     *handle
+	delta *handle
+}
+
+// GaugeHandle returns a GaugeHandle for stat and tags, sending with a sample
+// rate of 1 (see GaugeHandle.WithRate). See CounterHandle for details on
+// handles.
+func (s *Client) GaugeHandle(stat string, tags ...Tag) *GaugeHandle {
+	return &GaugeHandle{
+		h:     newHandle(s, stat, statGauge, 1, tags),
+		delta: newHandle(s, stat, statGaugeDelta, 1, tags),
+	}
+}
+
+// WithRate returns a copy of the handle, sending with the sample rate rate.
+func (g *GaugeHandle) WithRate(rate float32) *GaugeHandle {
+	if g == nil {
+		return nil
+	}
+	return &GaugeHandle{g.h.withRate(rate), g.delta.withRate(rate)}
+}
+
+// Gauge submits/updates the gauge.
+func (g *GaugeHandle) Gauge(value int64) error {
+	if g == nil {
+		return nil
+	}
+	return g.h.sendInt("", value)
+}
+
+// GaugeDelta submits a (positive or negative) change to the gauge.
+func (g *GaugeHandle) GaugeDelta(value int64) error {
+	if g == nil {
+		return nil
+	}
+	if value >= 0 {
+		return g.delta.sendInt("+", value)
+	}
+	return g.delta.sendInt("", value)
+}
+
+// GaugeFloat submits/updates the gauge with a float value.
+// Note: May not be supported by all servers.
+func (g *GaugeHandle) GaugeFloat(value float64) error {
+	if g == nil {
+		return nil
+	}
+	return g.h.sendFloat("", value)
+}
+
+// GaugeFloatDelta submits a (positive or negative) float change to the gauge.
+// Note: May not be supported by all servers.
+func (g *GaugeHandle) GaugeFloatDelta(value float64) error {
+	if g == nil {
+		return nil
+	}
+	if value >= 0 {
+		return g.delta.sendFloat("+", value)
+	}
+	return g.delta.sendFloat("", value)
+}
+
+// TimingHandle is a timing bound to a stat name and tags.
+// See Client.TimingHandle.
+type TimingHandle struct {
+	h *handle
+}
+
+// TimingHandle returns a TimingHandle for stat and tags, sending with a
+// sample rate of 1 (see TimingHandle.WithRate). See CounterHandle for details
+// on handles.
+func (s *Client) TimingHandle(stat string, tags ...Tag) *TimingHandle {
+	return &TimingHandle{newHandle(s, stat, statTiming, 1, tags)}
+}
+
+// WithRate returns a copy of the handle, sending with the sample rate rate.
+func (t *TimingHandle) WithRate(rate float32) *TimingHandle {
+	if t == nil {
+		return nil
+	}
+	return &TimingHandle{t.h.withRate(rate)}
+}
+
+// Timing submits a timing, in milliseconds.
+func (t *TimingHandle) Timing(delta int64) error {
+	if t == nil {
+		return nil
+	}
+	return t.h.sendInt("", delta)
+}
+
+// TimingDuration submits a timing as a time.Duration.
+func (t *TimingHandle) TimingDuration(delta time.Duration) error {
+	if t == nil {
+		return nil
+	}
+	ms := float64(delta) / float64(time.Millisecond)
+	return t.h.sendFloat("", ms)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureSender records every packet sent.
+type captureSender struct {
+	mx      sync.Mutex
+	packets []string
+}
+
+func (c *captureSender) Send(data []byte) (int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.packets = append(c.packets, string(data))
+	return len(data), nil
+}
+
+func (c *captureSender) Close() error {
+	return nil
+}
+
+// take returns and clears the recorded packets.
+func (c *captureSender) take() []string {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	p := c.packets
+	c.packets = nil
+	return p
+}
+
+func TestHandlesMatchClient(t *testing.T) {
+	tags := []Tag{{"tag1", "val1"}, {"tag2", "val2"}}
+
+	for _, tf := range []TagFormat{SuffixOctothorpe, InfixComma, InfixSemicolon, InfluxLine} {
+		for _, rate := range []float32{1, 0.999999} {
+			cs := &captureSender{}
+			// a fixed clock, for identical InfluxLine timestamps
+			st, err := newClientFromConfig(cs, &ClientConfig{
+				Prefix:    "test",
+				TagFormat: tf,
+				Clock:     newManualClock(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := st.(*Client)
+			c.SetSamplerFunc(func(float32) bool { return true })
+
+			counter := c.CounterHandle("count", tags...).WithRate(rate)
+			gauge := c.GaugeHandle("gauge", tags...).WithRate(rate)
+			timing := c.TimingHandle("timing", tags...).WithRate(rate)
+
+			counter.Inc(5)
+			counter.Dec(5)
+			gauge.Gauge(5)
+			gauge.GaugeDelta(5)
+			gauge.GaugeDelta(-5)
+			gauge.GaugeFloat(1.5)
+			gauge.GaugeFloatDelta(1.5)
+			gauge.GaugeFloatDelta(-1.5)
+			timing.Timing(5)
+			timing.TimingDuration(1500 * time.Microsecond)
+			got := cs.take()
+
+			c.Inc("count", 5, rate, tags...)
+			c.Dec("count", 5, rate, tags...)
+			c.Gauge("gauge", 5, rate, tags...)
+			c.GaugeDelta("gauge", 5, rate, tags...)
+			c.GaugeDelta("gauge", -5, rate, tags...)
+			c.GaugeFloat("gauge", 1.5, rate, tags...)
+			c.GaugeFloatDelta("gauge", 1.5, rate, tags...)
+			c.GaugeFloatDelta("gauge", -1.5, rate, tags...)
+			c.Timing("timing", 5, rate, tags...)
+			c.TimingDuration("timing", 1500*time.Microsecond, rate, tags...)
+			want := cs.take()
+
+			if len(got) != len(want) {
+				t.Fatalf("got %d packets, expected %d", len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("format %d: got '%s' expected '%s'", tf, got[i], want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestHandleSetPrefix(t *testing.T) {
+	cs := &captureSender{}
+	st, err := NewClientWithSender(cs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := st.(*Client).CounterHandle("count", Tag{"tag1", "val1"})
+	h.Inc(1)
+	st.SetPrefix("other")
+	h.Inc(1)
+
+	got := cs.take()
+	want := []string{"test.count:1|c|#tag1:val1", "other.count:1|c|#tag1:val1"}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %q expected %q", got, want)
+	}
+}
+
+func TestSubStatterHandles(t *testing.T) {
+	cs := &captureSender{}
+	st, err := NewClientWithSender(cs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, ok := st.NewSubStatter("sub").(HandleStatter)
+	if !ok {
+		t.Fatal("expected a SubStatter to implement HandleStatter")
+	}
+	sub.CounterHandle("count").Inc(1)
+	sub.GaugeHandle("gauge").GaugeDelta(-1)
+	sub.TimingHandle("timing").Timing(2)
+
+	got := cs.take()
+	want := []string{"test.sub.count:1|c", "test.sub.gauge:-1|g", "test.sub.timing:2|ms"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q expected %q", got, want)
+	}
+}
+
+func TestHandleValidation(t *testing.T) {
+	config := &ClientConfig{Prefix: "test", Validator: CheckName}
+	c, err := newClientFromConfig(&captureSender{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.(*Client).CounterHandle("co@unt").Inc(1); err == nil {
+		t.Fatal("expected a validation error")
+	}
+}
+
+func TestNilClientHandles(t *testing.T) {
+	var c *Client
+
+	if err := c.CounterHandle("count").Inc(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GaugeHandle("gauge").WithRate(0.5).GaugeDelta(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TimingHandle("timing").TimingDuration(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var h *CounterHandle
+	if err := h.WithRate(0.5).Inc(1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import "fmt"
+
+// MetricType is the type of a Metric.
+type MetricType uint8
+
+const (
+	MetricCount      = MetricType(statCount)
+	MetricGauge      = MetricType(statGauge)
+	MetricGaugeDelta = MetricType(statGaugeDelta)
+	MetricTiming     = MetricType(statTiming)
+	MetricSet        = MetricType(statSet)
+	MetricRaw        = MetricType(statRaw)
+)
+
+// Metric is a stat as seen by a MetricHook, before it is formatted.
+type Metric struct {
+	// Prefix is the prefix of the Client or SubStatter sending the stat.
+	Prefix string
+	// Name is the name of the stat, without the prefix.
+	Name string
+	Type MetricType
+	// Value is an int64, a float64 (for float values, and for TimingDuration
+	// in milliseconds), or a string (for Set and Raw).
+	// Dec sends a negated count.
+	Value interface{}
+	// Rate is the sample rate the stat is sent with. The stat has already
+	// been sampled.
+	Rate float32
+	// Tags holds the tags of the stat, including those of a SubStatter.
+	// It may be modified.
+	Tags []Tag
+}
+
+// MetricHook is a function called with every stat sent by a Client (after
+// sampling), before it is formatted. It may modify m, eg. to rename the stat
+// or remove tags, and returns false if the stat is to be dropped.
+//
+// Hooks are added with ClientConfig.MetricHooks or Client.AddMetricHook, and
+// are inherited by SubStatters.
+type MetricHook func(m *Metric) bool
+
+// AddMetricHook adds hook to the end of the hooks of the Client.
+// Hooks added to a SubStatter only apply to it (and SubStatters created from
+// it afterwards), not to its parent.
+//
+// Note that sending stats allocates while any hooks are set, and handles are
+// no longer pre-rendered.
+func (s *Client) AddMetricHook(hook MetricHook) {
+	if s == nil || hook == nil {
+		return
+	}
+
+	s.update(func(st *clientState) {
+		st.hooks = joinHooks(st.hooks, []MetricHook{hook})
+	})
+}
+
+// joinHooks returns a new slice holding hooks followed by more, or hooks if
+// more is empty.
+func joinHooks(hooks, more []MetricHook) []MetricHook {
+	if len(more) == 0 {
+		return hooks
+	}
+	joined := make([]MetricHook, 0, len(hooks)+len(more))
+	joined = append(joined, hooks...)
+	return append(joined, more...)
+}
+
+// newMetric returns a Metric for a stat passed to a submit method. The tags
+// are copied, as hooks may modify them.
+func (s *clientState) newMetric(stat string, kind statType, value interface{}, rate float32, tags []Tag) *Metric {
+	m := &Metric{
+		Prefix: s.prefix,
+		Name:   stat,
+		Type:   MetricType(kind),
+		Value:  value,
+		Rate:   rate,
+	}
+	if len(tags) != 0 {
+		m.Tags = make([]Tag, len(tags))
+		copy(m.Tags, tags)
+	}
+	return m
+}
+
+// runHooks runs the hooks on m, and writes the resulting stat.
+func (s *clientState) runHooks(m *Metric) error {
+	for _, hook := range s.hooks {
+		if !hook(m) {
+			return nil
+		}
+	}
+
+	kind := statType(m.Type)
+	if kind > statRaw {
+		return fmt.Errorf("invalid metric type %d", m.Type)
+	}
+	if !(m.Rate > 0) {
+		return fmt.Errorf("invalid metric rate %v", m.Rate)
+	}
+
+	switch v := m.Value.(type) {
+	case int64:
+		vprefix := ""
+		if kind == statGaugeDelta && v >= 0 {
+			vprefix = "+"
+		}
+		return s.writeInt(m.Prefix, m.Name, vprefix, v, kind, m.Rate, m.Tags)
+	case float64:
+		vprefix := ""
+		if kind == statGaugeDelta && v >= 0 {
+			vprefix = "+"
+		}
+		return s.writeFloat(m.Prefix, m.Name, vprefix, v, kind, m.Rate, m.Tags)
+	case string:
+		return s.writeString(m.Prefix, m.Name, v, kind, m.Rate, m.Tags)
+	}
+	return fmt.Errorf("invalid metric value type %T", m.Value)
+}
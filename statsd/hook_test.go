@@ -0,0 +1,165 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stripTag returns a MetricHook removing the tag key.
+func stripTag(key string) MetricHook {
+	return func(m *Metric) bool {
+		tags := m.Tags[:0]
+		for _, t := range m.Tags {
+			if t[0] != key {
+				tags = append(tags, t)
+			}
+		}
+		m.Tags = tags
+		return true
+	}
+}
+
+func TestClientMetricHooks(t *testing.T) {
+	cs := &captureSender{}
+	st, err := NewClientWithSender(cs, "test", InfixComma)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := st.(*Client)
+
+	var seen []Metric
+	c.AddMetricHook(func(m *Metric) bool {
+		cp := *m
+		cp.Tags = append([]Tag(nil), m.Tags...)
+		seen = append(seen, cp)
+		return true
+	})
+	c.AddMetricHook(stripTag("user_id"))
+	c.AddMetricHook(func(m *Metric) bool {
+		return !strings.HasPrefix(m.Name, "debug.")
+	})
+	c.AddMetricHook(func(m *Metric) bool {
+		m.Name = strings.ToLower(m.Name)
+		return true
+	})
+
+	c.Inc("Count", 1, 1, Tag{"user_id", "42"}, Tag{"route", "/"})
+	c.GaugeDelta("gauge", 2, 1)
+	c.GaugeFloatDelta("gauge", -1.5, 1)
+	c.TimingDuration("timing", time.Millisecond, 1)
+	c.Set("set", "member", 1)
+	c.Inc("debug.count", 1, 1)
+	c.CounterHandle("handle", Tag{"user_id", "42"}).Inc(1)
+
+	expected := []string{
+		"test.count,route=/:1|c",
+		"test.gauge:+2|g",
+		"test.gauge:-1.5|g",
+		"test.timing:1|ms",
+		"test.set:member|s",
+		"test.handle:1|c",
+	}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+
+	first := Metric{
+		Prefix: "test",
+		Name:   "Count",
+		Type:   MetricCount,
+		Value:  int64(1),
+		Rate:   1,
+		Tags:   []Tag{{"user_id", "42"}, {"route", "/"}},
+	}
+	if len(seen) != 7 || !reflect.DeepEqual(seen[0], first) {
+		t.Fatalf("got %+v expected %+v", seen[0], first)
+	}
+	if seen[5].Type != MetricCount || seen[3].Value != 1.0 {
+		t.Fatalf("unexpected metrics %+v", seen)
+	}
+}
+
+func TestClientMetricHookRewrite(t *testing.T) {
+	cs := &captureSender{}
+	c, err := NewClientWithSender(cs, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.(*Client).Reconfigure(&ClientConfig{
+		Prefix: "test",
+		MetricHooks: []MetricHook{func(m *Metric) bool {
+			m.Prefix = "other"
+			m.Type = MetricGauge
+			m.Value = 2.5
+			return true
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Inc("count", 1, 1)
+	if got := cs.take(); len(got) != 1 || got[0] != "other.count:2.5|g" {
+		t.Fatalf("got %q", got)
+	}
+
+	c.(*Client).AddMetricHook(func(m *Metric) bool {
+		m.Value = true
+		return true
+	})
+	if err := c.Inc("count", 1, 1); err == nil {
+		t.Fatal("expected an error for an invalid value type")
+	}
+
+	c.(*Client).AddMetricHook(func(m *Metric) bool {
+		m.Value = int64(1)
+		m.Rate = 0
+		return true
+	})
+	if err := c.Inc("count", 1, 1); err == nil {
+		t.Fatal("expected an error for an invalid rate")
+	}
+}
+
+func TestSubStatterMetricHooks(t *testing.T) {
+	cs := &captureSender{}
+	st, err := NewClientWithSender(cs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := st.(*Client)
+	c.AddMetricHook(func(m *Metric) bool {
+		m.Name += ".parent"
+		return true
+	})
+
+	fixed := c.NewSubStatter("fixed")
+	live := c.NewSubStatterWithConfig(&SubStatterConfig{Prefix: "live", Live: true})
+	fixed.(*Client).AddMetricHook(func(m *Metric) bool {
+		m.Name += ".fixed"
+		return true
+	})
+	c.AddMetricHook(func(m *Metric) bool {
+		m.Name += ".later"
+		return true
+	})
+
+	c.Inc("count", 1, 1)
+	fixed.Inc("count", 1, 1)
+	live.Inc("count", 1, 1)
+
+	expected := []string{
+		"test.count.parent.later:1|c",
+		"test.fixed.count.parent.fixed:1|c",
+		"test.live.count.parent.later:1|c",
+	}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// influxField returns the line protocol field key used for a stat type.
+func (t statType) influxField() string {
+	switch t {
+	case statCount:
+		return "count"
+	case statGauge:
+		return "gauge"
+	case statGaugeDelta:
+		return "gauge_delta"
+	case statTiming:
+		return "timing"
+	case statSet:
+		return "set"
+	}
+	return "value"
+}
+
+// The functions below write stats in InfluxDB line protocol format.
+//
+// The prefixed stat name becomes the measurement, tags become line protocol
+// tags, and the value is written to a field named after the stat type (see
+// statType.influxField). InfluxDB rejects a field written with different
+// types, so the type of a field only depends on the stat type: counts are
+// integer fields, gauges, timings and raw values float fields, and set
+// members string fields. A sample rate below 1 is written as an additional
+// sample_rate field. The timestamp is the time the stat is formatted, in
+// nanoseconds. Tags with an empty key or value, which the line protocol does
+// not allow, are left out.
+
+// appendInfluxHead appends the measurement, tags and field key to data.
+func appendInfluxHead(data []byte, prefix, stat string, kind statType, tags []Tag) []byte {
+	if prefix != "" {
+		data = appendInfluxEscaped(data, prefix, false)
+		data = append(data, '.')
+	}
+	data = appendInfluxEscaped(data, stat, false)
+
+	for _, v := range tags {
+		if v[0] == "" || v[1] == "" {
+			continue
+		}
+		data = append(data, ',')
+		data = appendInfluxEscaped(data, v[0], true)
+		data = append(data, '=')
+		data = appendInfluxEscaped(data, v[1], true)
+	}
+
+	data = append(data, ' ')
+	data = append(data, kind.influxField()...)
+	return append(data, '=')
+}
+
+// appendInfluxInt appends an integer value to data, as a field of the type
+// used for kind.
+func appendInfluxInt(data []byte, v int64, kind statType) []byte {
+	switch kind {
+	case statCount:
+		data = strconv.AppendInt(data, v, 10)
+		return append(data, 'i')
+	case statSet:
+		data = append(data, '"')
+		data = strconv.AppendInt(data, v, 10)
+		return append(data, '"')
+	}
+	// an integer without the i suffix is a float field
+	return strconv.AppendInt(data, v, 10)
+}
+
+// appendInfluxFloat appends a float value to data, as a field of the type
+// used for kind.
+func appendInfluxFloat(data []byte, v float64, kind statType) ([]byte, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return data, fmt.Errorf("invalid float value for line protocol: %v", v)
+	}
+	if kind == statSet {
+		data = append(data, '"')
+		data = strconv.AppendFloat(data, v, 'f', -1, 64)
+		return append(data, '"'), nil
+	}
+	return strconv.AppendFloat(data, v, 'f', -1, 64), nil
+}
+
+// appendInfluxStringValue appends a set member to data as a string field, or
+// a raw value as a float field. Raw values must be finite numbers.
+func appendInfluxStringValue(data []byte, v string, kind statType) ([]byte, error) {
+	if kind != statRaw {
+		return appendInfluxString(data, v), nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return data, fmt.Errorf("invalid raw value for line protocol: %q", v)
+	}
+	return appendInfluxFloat(data, f, kind)
+}
+
+// appendInfluxTail appends the sample rate field, if any, and the timestamp
+// now to data.
+func appendInfluxTail(data []byte, rate float32, now time.Time) []byte {
+	if rate < 1 {
+		data = append(data, ",sample_rate="...)
+		data = appendRate(data, rate)
+	}
+	data = append(data, ' ')
+	return strconv.AppendInt(data, now.UnixNano(), 10)
+}
+
+// appendInfluxEscaped appends s to data, escaping commas, spaces and
+// backslashes (so that a trailing one does not escape the following
+// separator) with a backslash. If tag is true, equals signs are escaped as
+// well, as required for tag keys and tag values.
+func appendInfluxEscaped(data []byte, s string, tag bool) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ',', c == ' ', c == '\\', tag && c == '=':
+			data = append(data, '\\', c)
+		default:
+			data = append(data, c)
+		}
+	}
+	return data
+}
+
+// appendInfluxString appends s to data as a double quoted line protocol
+// string field value.
+func appendInfluxString(data []byte, s string) []byte {
+	data = append(data, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' {
+			data = append(data, '\\')
+		}
+		data = append(data, c)
+	}
+	return append(data, '"')
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SenderMiddleware wraps a Sender, returning a Sender adding some behavior,
+// such as logging or rate limiting. The returned Sender is responsible for
+// closing the wrapped Sender.
+//
+// See ClientConfig.Middleware.
+type SenderMiddleware func(Sender) Sender
+
+// ErrRateLimited is returned by a Sender from RateLimitMiddleware for data
+// exceeding the rate limit.
+var ErrRateLimited = errors.New("statsd: send rate limit exceeded")
+
+// wrappedSender is embedded by the Senders of the standard middlewares,
+// forwarding Close and Flush to the wrapped Sender.
+type wrappedSender struct {
+	next Sender
+}
+
+// Close closes the wrapped Sender.
+func (s wrappedSender) Close() error {
+	return s.next.Close()
+}
+
+// Flush flushes the wrapped Sender, if it buffers stats.
+func (s wrappedSender) Flush() error {
+	if f, ok := s.next.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// RateLimitMiddleware returns a SenderMiddleware limiting the data sent to
+// bytesPerSec bytes per second, allowing bursts of up to burst bytes. If burst
+// is 0, it defaults to bytesPerSec. Data exceeding the limit is discarded,
+// and ErrRateLimited returned.
+func RateLimitMiddleware(bytesPerSec, burst int) SenderMiddleware {
+	return RateLimitMiddlewareWithClock(bytesPerSec, burst, nil)
+}
+
+// RateLimitMiddlewareWithClock is like RateLimitMiddleware, but measures time
+// with clock (or the system clock, if nil), eg. the Clock of the ClientConfig
+// the middleware is used with.
+func RateLimitMiddlewareWithClock(bytesPerSec, burst int, clock Clock) SenderMiddleware {
+	if burst <= 0 {
+		burst = bytesPerSec
+	}
+	clock = clockOrSystem(clock)
+	return func(next Sender) Sender {
+		return &rateLimitSender{
+			wrappedSender: wrappedSender{next},
+			rate:          float64(bytesPerSec),
+			burst:         float64(burst),
+			clock:         clock,
+			tokens:        float64(burst),
+			last:          clock.Now(),
+		}
+	}
+}
+
+// rateLimitSender is a token bucket, holding a token per byte.
+type rateLimitSender struct {
+	wrappedSender
+	rate  float64
+	burst float64
+	clock Clock
+	// bucket state
+	mx     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// Send data, if within the rate limit.
+func (s *rateLimitSender) Send(data []byte) (int, error) {
+	if !s.take(len(data)) {
+		return 0, ErrRateLimited
+	}
+	return s.next.Send(data)
+}
+
+// take takes n tokens from the bucket, if available.
+func (s *rateLimitSender) take(n int) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := s.clock.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.rate
+	if s.tokens > s.burst {
+		s.tokens = s.burst
+	}
+	s.last = now
+
+	if s.tokens < float64(n) {
+		return false
+	}
+	s.tokens -= float64(n)
+	return true
+}
+
+// LogMiddleware returns a SenderMiddleware logging all data sent, and any
+// send errors, to logger. If logger is nil, the standard logger is used.
+//
+// This is intended for debugging, as every send is logged.
+func LogMiddleware(logger *log.Logger) SenderMiddleware {
+	return func(next Sender) Sender {
+		return &logSender{wrappedSender{next}, logger}
+	}
+}
+
+type logSender struct {
+	wrappedSender
+	// nil for the standard logger
+	logger *log.Logger
+}
+
+func (s *logSender) printf(format string, v ...interface{}) {
+	if s.logger == nil {
+		log.Printf(format, v...)
+		return
+	}
+	s.logger.Printf(format, v...)
+}
+
+// Send data, logging it.
+func (s *logSender) Send(data []byte) (int, error) {
+	n, err := s.next.Send(data)
+	if err != nil {
+		s.printf("statsd: send %q: %s", data, err)
+	} else {
+		s.printf("statsd: sent %q", data)
+	}
+	return n, err
+}
+
+// SendCounter counts the data sent by Senders wrapped with its Middleware
+// method, eg.
+//
+//	counter := &statsd.SendCounter{}
+//	config.Middleware = []statsd.SenderMiddleware{counter.Middleware}
+//
+// The counts are kept when a Client is reconfigured with the same
+// SendCounter. It is safe for concurrent use.
+type SendCounter struct {
+	// accessed atomically, kept first for 64-bit alignment
+	sends  uint64
+	bytes  uint64
+	errors uint64
+}
+
+// Middleware is a SenderMiddleware, counting the data sent by next.
+func (c *SendCounter) Middleware(next Sender) Sender {
+	return &countSender{wrappedSender{next}, c}
+}
+
+// Sends returns the number of successful sends.
+func (c *SendCounter) Sends() uint64 {
+	return atomic.LoadUint64(&c.sends)
+}
+
+// Bytes returns the number of bytes successfully sent.
+func (c *SendCounter) Bytes() uint64 {
+	return atomic.LoadUint64(&c.bytes)
+}
+
+// Errors returns the number of failed sends.
+func (c *SendCounter) Errors() uint64 {
+	return atomic.LoadUint64(&c.errors)
+}
+
+type countSender struct {
+	wrappedSender
+	counter *SendCounter
+}
+
+// Send data, counting it.
+func (s *countSender) Send(data []byte) (int, error) {
+	n, err := s.next.Send(data)
+	if err != nil {
+		atomic.AddUint64(&s.counter.errors, 1)
+	} else {
+		atomic.AddUint64(&s.counter.sends, 1)
+		atomic.AddUint64(&s.counter.bytes, uint64(n))
+	}
+	return n, err
+}
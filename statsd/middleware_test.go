@@ -0,0 +1,180 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// funcSender is a Sender calling send.
+type funcSender struct {
+	wrappedSender
+	send func([]byte) (int, error)
+}
+
+func (s *funcSender) Send(data []byte) (int, error) {
+	return s.send(data)
+}
+
+func TestClientMiddleware(t *testing.T) {
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var order []string
+	marker := func(name string) SenderMiddleware {
+		return func(next Sender) Sender {
+			return &funcSender{wrappedSender{next}, func(data []byte) (int, error) {
+				order = append(order, name)
+				return next.Send(data)
+			}}
+		}
+	}
+	counter := &SendCounter{}
+
+	c, err := NewClientWithConfig(&ClientConfig{
+		Address:    l.LocalAddr().String(),
+		Prefix:     "test",
+		Middleware: []SenderMiddleware{marker("inner"), counter.Middleware, marker("outer")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readPacket(t, l), "test.count:1|c"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+	if expected := []string{"outer", "inner"}; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("got %q expected %q", order, expected)
+	}
+	if counter.Sends() != 1 || counter.Bytes() != uint64(len("test.count:1|c")) {
+		t.Fatalf("unexpected counts: %d sends, %d bytes", counter.Sends(), counter.Bytes())
+	}
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	cs := &captureSender{}
+	sender, err := NewBufferedSenderWithSender(cs, time.Hour, 1432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &SendCounter{}
+	sender = counter.Middleware(LogMiddleware(log.New(&bytes.Buffer{}, "", 0))(sender))
+
+	c, err := NewClientWithSender(sender, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Inc("count", 1, 1)
+	if err := c.(*Client).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cs.take(); len(got) != 1 || got[0] != "test.count:1|c" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cs := &captureSender{}
+	s := RateLimitMiddleware(1, 10)(cs)
+
+	if _, err := s.Send([]byte("12345678")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send([]byte("12345678")); err != ErrRateLimited {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if got := cs.take(); len(got) != 1 {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestRateLimitMiddlewareClock(t *testing.T) {
+	cs := &captureSender{}
+	clock := newManualClock()
+	s := RateLimitMiddlewareWithClock(4, 8, clock)(cs)
+
+	if _, err := s.Send([]byte("12345678")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send([]byte("1234")); err != ErrRateLimited {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	// refills 4 bytes per second
+	clock.advance(time.Second)
+	if _, err := s.Send([]byte("1234")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send([]byte("1")); err != ErrRateLimited {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if got := cs.take(); len(got) != 2 {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	s := LogMiddleware(log.New(&buf, "", 0))(errSender{})
+
+	if _, err := s.Send([]byte("test.count:1|c")); err == nil {
+		t.Fatal("expected an error")
+	}
+	s = LogMiddleware(log.New(&buf, "", 0))(&captureSender{})
+	if _, err := s.Send([]byte("test.count:1|c")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`statsd: send "test.count:1|c": send failed`,
+		`statsd: sent "test.count:1|c"`,
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+}
+
+func TestLogMiddlewareStandardLogger(t *testing.T) {
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+
+	s := LogMiddleware(nil)(&captureSender{})
+	if _, err := s.Send([]byte("test.count:1|c")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "statsd: sent \"test.count:1|c\"\n"; got != want {
+		t.Fatalf("got %q expected %q", got, want)
+	}
+}
+
+func TestSendCounter(t *testing.T) {
+	counter := &SendCounter{}
+	counter.Middleware(errSender{}).Send([]byte("test"))
+	counter.Middleware(&captureSender{}).Send([]byte("test"))
+
+	if counter.Sends() != 1 || counter.Bytes() != 4 || counter.Errors() != 1 {
+		t.Fatalf("unexpected counts: %d sends, %d bytes, %d errors",
+			counter.Sends(), counter.Bytes(), counter.Errors())
+	}
+}
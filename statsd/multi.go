@@ -0,0 +1,377 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MultiStatter is a Statter forwarding every stat to several Statters.
+//
+// Each Statter formats and sends stats with its own settings (prefix, tag
+// format, sampler, etc.), so that stats may be sent to backends using
+// different tag formats at the same time (eg. while migrating between
+// backends). This differs from sending the same bytes to several addresses.
+//
+// Errors returned by the Statters are returned together as a *MultiError.
+type MultiStatter struct {
+	// Statters, or SubStatters for a MultiStatter returned by NewSubStatter
+	statters []StatSender
+	// the MultiStatter this one was created from, nil if from NewMultiStatter
+	parent *MultiStatter
+	// prefix appended to those of the statters
+	prefix string
+}
+
+// NewMultiStatter returns a Statter forwarding stats to statters. The
+// returned value is a *MultiStatter, which also implements
+// ExtendedStatSender, ExtendedSubStatter and HandleStatter.
+func NewMultiStatter(statters ...Statter) Statter {
+	m := &MultiStatter{statters: make([]StatSender, len(statters))}
+	for i, s := range statters {
+		m.statters[i] = s
+	}
+	return m
+}
+
+// each calls fn with every statter, joining the errors.
+func (m *MultiStatter) each(fn func(StatSender) error) error {
+	if m == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, s := range m.statters {
+		if err := fn(s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return JoinErrors(errs)
+}
+
+// eachExtended is like each, for ExtendedStatSender methods. Statters not
+// implementing ExtendedStatSender result in an error.
+func (m *MultiStatter) eachExtended(method string, fn func(ExtendedStatSender) error) error {
+	return m.each(func(s StatSender) error {
+		es, ok := s.(ExtendedStatSender)
+		if !ok {
+			return fmt.Errorf("%T does not support %s", s, method)
+		}
+		return fn(es)
+	})
+}
+
+// Inc increments a statsd count type.
+func (m *MultiStatter) Inc(stat string, value int64, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.Inc(stat, value, rate, tags...)
+	})
+}
+
+// Dec decrements a statsd count type.
+func (m *MultiStatter) Dec(stat string, value int64, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.Dec(stat, value, rate, tags...)
+	})
+}
+
+// Gauge submits/updates a statsd gauge type.
+func (m *MultiStatter) Gauge(stat string, value int64, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.Gauge(stat, value, rate, tags...)
+	})
+}
+
+// GaugeDelta submits a delta to a statsd gauge.
+func (m *MultiStatter) GaugeDelta(stat string, value int64, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.GaugeDelta(stat, value, rate, tags...)
+	})
+}
+
+// GaugeFloat submits/updates a float statsd gauge type.
+func (m *MultiStatter) GaugeFloat(stat string, value float64, rate float32, tags ...Tag) error {
+	return m.eachExtended("GaugeFloat", func(s ExtendedStatSender) error {
+		return s.GaugeFloat(stat, value, rate, tags...)
+	})
+}
+
+// GaugeFloatDelta submits a float delta to a statsd gauge.
+func (m *MultiStatter) GaugeFloatDelta(stat string, value float64, rate float32, tags ...Tag) error {
+	return m.eachExtended("GaugeFloatDelta", func(s ExtendedStatSender) error {
+		return s.GaugeFloatDelta(stat, value, rate, tags...)
+	})
+}
+
+// Timing submits a statsd timing type.
+func (m *MultiStatter) Timing(stat string, delta int64, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.Timing(stat, delta, rate, tags...)
+	})
+}
+
+// TimingDuration submits a statsd timing type.
+func (m *MultiStatter) TimingDuration(stat string, delta time.Duration, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.TimingDuration(stat, delta, rate, tags...)
+	})
+}
+
+// Set submits a stats set type.
+func (m *MultiStatter) Set(stat string, value string, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.Set(stat, value, rate, tags...)
+	})
+}
+
+// SetInt submits a number as a stats set type.
+func (m *MultiStatter) SetInt(stat string, value int64, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.SetInt(stat, value, rate, tags...)
+	})
+}
+
+// SetFloat submits a float number as a stats set type.
+func (m *MultiStatter) SetFloat(stat string, value float64, rate float32, tags ...Tag) error {
+	return m.eachExtended("SetFloat", func(s ExtendedStatSender) error {
+		return s.SetFloat(stat, value, rate, tags...)
+	})
+}
+
+// Raw submits a preformatted value.
+func (m *MultiStatter) Raw(stat string, value string, rate float32, tags ...Tag) error {
+	return m.each(func(s StatSender) error {
+		return s.Raw(stat, value, rate, tags...)
+	})
+}
+
+// handleStatter returns s as a HandleStatter, or a handle failing every
+// send if it does not implement it.
+func handleStatter(s StatSender, method string) (HandleStatter, *handle) {
+	hs, ok := s.(HandleStatter)
+	if !ok {
+		return nil, &handle{err: fmt.Errorf("%T does not support %s", s, method)}
+	}
+	return hs, nil
+}
+
+// CounterHandle returns a CounterHandle sending to a CounterHandle of every
+// Statter. Statters not implementing HandleStatter result in an error on
+// every send. See Client.CounterHandle for details on handles.
+func (m *MultiStatter) CounterHandle(stat string, tags ...Tag) *CounterHandle {
+	if m == nil {
+		return (*Client)(nil).CounterHandle(stat)
+	}
+
+	c := &CounterHandle{&handle{}}
+	for _, s := range m.statters {
+		hs, h := handleStatter(s, "CounterHandle")
+		if hs != nil {
+			h = hs.CounterHandle(stat, tags...).h
+		}
+		c.h.multi = append(c.h.multi, h)
+	}
+	return c
+}
+
+// GaugeHandle returns a GaugeHandle sending to a GaugeHandle of every
+// Statter, like CounterHandle.
+func (m *MultiStatter) GaugeHandle(stat string, tags ...Tag) *GaugeHandle {
+	if m == nil {
+		return (*Client)(nil).GaugeHandle(stat)
+	}
+
+	g := &GaugeHandle{h: &handle{}, delta: &handle{}}
+	for _, s := range m.statters {
+		hs, h := handleStatter(s, "GaugeHandle")
+		delta := h
+		if hs != nil {
+			sg := hs.GaugeHandle(stat, tags...)
+			h, delta = sg.h, sg.delta
+		}
+		g.h.multi = append(g.h.multi, h)
+		g.delta.multi = append(g.delta.multi, delta)
+	}
+	return g
+}
+
+// TimingHandle returns a TimingHandle sending to a TimingHandle of every
+// Statter, like CounterHandle.
+func (m *MultiStatter) TimingHandle(stat string, tags ...Tag) *TimingHandle {
+	if m == nil {
+		return (*Client)(nil).TimingHandle(stat)
+	}
+
+	t := &TimingHandle{&handle{}}
+	for _, s := range m.statters {
+		hs, h := handleStatter(s, "TimingHandle")
+		if hs != nil {
+			h = hs.TimingHandle(stat, tags...).h
+		}
+		t.h.multi = append(t.h.multi, h)
+	}
+	return t
+}
+
+// SetPrefix sets the prefix of every Statter (or SubStatter supporting it,
+// such as a SubStatter returned by a Client).
+func (m *MultiStatter) SetPrefix(prefix string) {
+	m.each(func(s StatSender) error {
+		if ps, ok := s.(interface{ SetPrefix(string) }); ok {
+			ps.SetPrefix(prefix)
+		}
+		return nil
+	})
+}
+
+// SetSamplerFunc sets the sampler function of every Statter supporting it,
+// such as a Client.
+func (m *MultiStatter) SetSamplerFunc(sampler SamplerFunc) {
+	m.each(func(s StatSender) error {
+		if ss, ok := s.(interface{ SetSamplerFunc(SamplerFunc) }); ok {
+			ss.SetSamplerFunc(sampler)
+		}
+		return nil
+	})
+}
+
+// NewSubStatter returns a MultiStatter forwarding stats to a SubStatter of
+// every Statter, each with prefix appended to its own prefix.
+func (m *MultiStatter) NewSubStatter(prefix string) SubStatter {
+	return m.NewSubStatterWithConfig(&SubStatterConfig{Prefix: prefix})
+}
+
+// NewSubStatterWithConfig is like NewSubStatter, creating the SubStatters
+// with config. Statters only supporting NewSubStatter are passed the prefix
+// of config.
+func (m *MultiStatter) NewSubStatterWithConfig(config *SubStatterConfig) ExtendedSubStatter {
+	var sub *MultiStatter
+	if m == nil {
+		return sub
+	}
+
+	if config == nil {
+		config = &SubStatterConfig{}
+	}
+
+	sub = &MultiStatter{
+		statters: make([]StatSender, 0, len(m.statters)),
+		parent:   m,
+		prefix:   joinPathComp(m.prefix, config.Prefix),
+	}
+	for _, s := range m.statters {
+		switch ss := s.(type) {
+		case interface {
+			NewSubStatterWithConfig(*SubStatterConfig) ExtendedSubStatter
+		}:
+			sub.statters = append(sub.statters, ss.NewSubStatterWithConfig(config))
+		case interface{ NewSubStatter(string) SubStatter }:
+			sub.statters = append(sub.statters, ss.NewSubStatter(config.Prefix))
+		}
+	}
+	return sub
+}
+
+// Prefix returns the prefix appended to those of the Statters, if this
+// MultiStatter was returned by NewSubStatter.
+func (m *MultiStatter) Prefix() string {
+	if m == nil {
+		return ""
+	}
+	return m.prefix
+}
+
+// Parent returns the MultiStatter this one was created from with
+// NewSubStatter, or nil.
+func (m *MultiStatter) Parent() SubStatter {
+	if m == nil || m.parent == nil {
+		return nil
+	}
+	return m.parent
+}
+
+// Flush flushes every Statter supporting it, such as a Client.
+func (m *MultiStatter) Flush() error {
+	return m.each(func(s StatSender) error {
+		if f, ok := s.(flusher); ok {
+			return f.Flush()
+		}
+		return nil
+	})
+}
+
+// Close closes every Statter. For a MultiStatter returned by NewSubStatter,
+// this closes the SubStatters, leaving the senders of their parents open.
+func (m *MultiStatter) Close() error {
+	return m.each(func(s StatSender) error {
+		if c, ok := s.(interface{ Close() error }); ok {
+			return c.Close()
+		}
+		return nil
+	})
+}
+
+// MultiError holds several errors, such as those returned by the Statters of
+// a MultiStatter. errors.Is and errors.As match any of them.
+//
+// It is always used as a *MultiError, so that errors may be compared.
+type MultiError struct {
+	errs []error
+}
+
+// JoinErrors returns nil if errs is empty, the error itself if it holds a
+// single one, and a *MultiError otherwise.
+func JoinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &MultiError{errs: append([]error(nil), errs...)}
+}
+
+// Errors returns the errors.
+func (e *MultiError) Errors() []error {
+	return e.errs
+}
+
+// Error returns the messages of the errors, one per line.
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors.
+func (e *MultiError) Unwrap() []error {
+	return e.errs
+}
+
+// Is reports whether any of the errors matches target.
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target, and if so, sets
+// target to it and returns true.
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// errSender fails every send.
+type errSender struct{}
+
+func (errSender) Send(data []byte) (int, error) {
+	return 0, errors.New("send failed")
+}
+
+func (errSender) Close() error {
+	return nil
+}
+
+// basicStatter is a Statter not implementing ExtendedStatSender.
+type basicStatter struct {
+	Statter
+}
+
+func newMultiTestStatter(t *testing.T, senders ...Sender) (Statter, []*captureSender) {
+	var statters []Statter
+	var captured []*captureSender
+	for i, tf := range []TagFormat{SuffixOctothorpe, InfixSemicolon} {
+		cs := &captureSender{}
+		c, err := NewClientWithSender(cs, []string{"one", "two"}[i], tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statters = append(statters, c)
+		captured = append(captured, cs)
+	}
+	for _, s := range senders {
+		c, err := NewClientWithSender(s, "other", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statters = append(statters, c)
+	}
+	return NewMultiStatter(statters...), captured
+}
+
+func TestMultiStatter(t *testing.T) {
+	m, captured := newMultiTestStatter(t)
+	tags := []Tag{{"tag1", "val1"}}
+
+	multiTests := []struct {
+		Method   string
+		Func     func() error
+		Expected []string
+	}{
+		{"Inc", func() error { return m.Inc("count", 1, 1, tags...) },
+			[]string{"one.count:1|c|#tag1:val1", "two.count;tag1=val1:1|c"}},
+		{"Dec", func() error { return m.Dec("count", 1, 1) },
+			[]string{"one.count:-1|c", "two.count:-1|c"}},
+		{"Gauge", func() error { return m.Gauge("gauge", 1, 1) },
+			[]string{"one.gauge:1|g", "two.gauge:1|g"}},
+		{"GaugeDelta", func() error { return m.GaugeDelta("gauge", 1, 1) },
+			[]string{"one.gauge:+1|g", "two.gauge:+1|g"}},
+		{"GaugeFloat", func() error { return m.(ExtendedStatSender).GaugeFloat("gauge", 1.5, 1) },
+			[]string{"one.gauge:1.5|g", "two.gauge:1.5|g"}},
+		{"GaugeFloatDelta", func() error { return m.(ExtendedStatSender).GaugeFloatDelta("gauge", -1.5, 1) },
+			[]string{"one.gauge:-1.5|g", "two.gauge:-1.5|g"}},
+		{"Timing", func() error { return m.Timing("timing", 1, 1) },
+			[]string{"one.timing:1|ms", "two.timing:1|ms"}},
+		{"TimingDuration", func() error { return m.TimingDuration("timing", time.Millisecond, 1) },
+			[]string{"one.timing:1|ms", "two.timing:1|ms"}},
+		{"Set", func() error { return m.Set("set", "member", 1) },
+			[]string{"one.set:member|s", "two.set:member|s"}},
+		{"SetInt", func() error { return m.SetInt("set", 1, 1) },
+			[]string{"one.set:1|s", "two.set:1|s"}},
+		{"SetFloat", func() error { return m.(ExtendedStatSender).SetFloat("set", 1.5, 1) },
+			[]string{"one.set:1.5|s", "two.set:1.5|s"}},
+		{"Raw", func() error { return m.Raw("raw", "1|c", 1) },
+			[]string{"one.raw:1|c", "two.raw:1|c"}},
+	}
+
+	for _, tt := range multiTests {
+		if err := tt.Func(); err != nil {
+			t.Fatalf("%s: %s", tt.Method, err)
+		}
+		for i, cs := range captured {
+			got := cs.take()
+			if len(got) != 1 || got[0] != tt.Expected[i] {
+				t.Fatalf("%s: got %q expected %q", tt.Method, got, tt.Expected[i])
+			}
+		}
+	}
+}
+
+func TestMultiStatterErrors(t *testing.T) {
+	m, captured := newMultiTestStatter(t, errSender{}, errSender{})
+
+	err := m.Inc("count", 1, 1)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := len(err.(*MultiError).Errors()); n != 2 {
+		t.Fatalf("expected 2 joined errors, got %d", n)
+	}
+	// joined errors may be compared without panicking
+	if err == JoinErrors(err.(*MultiError).Errors()) {
+		t.Fatal("expected joined errors to be compared by identity")
+	}
+	// the other statters still got the stat
+	for _, cs := range captured {
+		if got := cs.take(); len(got) != 1 {
+			t.Fatalf("got %q", got)
+		}
+	}
+
+	c, err := NewClientWithSender(&captureSender{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewMultiStatter(c, basicStatter{c})
+	if err := m.(ExtendedStatSender).GaugeFloat("gauge", 1, 1); err == nil {
+		t.Fatal("expected an error for a Statter without GaugeFloat")
+	}
+}
+
+func TestMultiSubStatter(t *testing.T) {
+	m, captured := newMultiTestStatter(t)
+
+	s := m.NewSubStatter("sub").(ExtendedSubStatter)
+	ss := s.NewSubStatterWithConfig(&SubStatterConfig{
+		Prefix: "subsub",
+		Tags:   []Tag{{"tag1", "val1"}},
+	})
+
+	if err := ss.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"one.sub.subsub.count:1|c|#tag1:val1", "two.sub.subsub.count;tag1=val1:1|c"}
+	for i, cs := range captured {
+		if got := cs.take(); !reflect.DeepEqual(got, expected[i:i+1]) {
+			t.Fatalf("got %q expected %q", got, expected[i])
+		}
+	}
+
+	if got, want := ss.Prefix(), "sub.subsub"; got != want {
+		t.Fatalf("got '%s' expected '%s'", got, want)
+	}
+	if ss.Parent() != s || s.Parent() != m.(*MultiStatter) {
+		t.Fatal("unexpected parent")
+	}
+	if m.(*MultiStatter).Parent() != nil {
+		t.Fatal("expected no parent")
+	}
+
+	// closing the SubStatters leaves the Statters open
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"one.count:1|c", "two.count:1|c"}
+	for i, cs := range captured {
+		if got := cs.take(); !reflect.DeepEqual(got, expected[i:i+1]) {
+			t.Fatalf("got %q expected %q", got, expected[i])
+		}
+	}
+}
+
+func TestMultiStatterHandles(t *testing.T) {
+	m, captured := newMultiTestStatter(t)
+	m.(*MultiStatter).SetSamplerFunc(func(float32) bool { return true })
+	hs := m.NewSubStatter("sub").(HandleStatter)
+	tags := []Tag{{"tag1", "val1"}}
+
+	handleTests := []struct {
+		Method   string
+		Func     func() error
+		Expected []string
+	}{
+		{"Inc", func() error { return hs.CounterHandle("count", tags...).Inc(1) },
+			[]string{"one.sub.count:1|c|#tag1:val1", "two.sub.count;tag1=val1:1|c"}},
+		{"Gauge", func() error { return hs.GaugeHandle("gauge", tags...).WithRate(0.999999).Gauge(1) },
+			[]string{"one.sub.gauge:1|g|@0.999999|#tag1:val1", "two.sub.gauge;tag1=val1:1|g|@0.999999"}},
+		{"GaugeDelta", func() error { return hs.GaugeHandle("gauge", tags...).GaugeDelta(1) },
+			[]string{"one.sub.gauge:+1|g|#tag1:val1", "two.sub.gauge;tag1=val1:+1|g"}},
+		{"TimingDuration", func() error { return hs.TimingHandle("timing", tags...).TimingDuration(time.Millisecond) },
+			[]string{"one.sub.timing:1|ms|#tag1:val1", "two.sub.timing;tag1=val1:1|ms"}},
+	}
+
+	for _, tt := range handleTests {
+		if err := tt.Func(); err != nil {
+			t.Fatalf("%s: %s", tt.Method, err)
+		}
+		for i, cs := range captured {
+			if got := cs.take(); !reflect.DeepEqual(got, tt.Expected[i:i+1]) {
+				t.Fatalf("%s: got %q expected %q", tt.Method, got, tt.Expected[i])
+			}
+		}
+	}
+
+	c, err := NewClientWithSender(&captureSender{}, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewMultiStatter(c, basicStatter{c})
+	if err := m.(HandleStatter).GaugeHandle("gauge").GaugeDelta(1); err == nil {
+		t.Fatal("expected an error for a Statter without handles")
+	}
+}
+
+func TestNilMultiStatter(t *testing.T) {
+	var m *MultiStatter
+	if err := m.Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewSubStatter("sub").Inc("count", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CounterHandle("count").Inc(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
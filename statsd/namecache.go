@@ -0,0 +1,66 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import "sync"
+
+// nameCache is a concurrency-safe cache of values by full stat name, such as
+// the results of filtering or renaming a name. It holds at most size names,
+// and is cleared when full, so that memory stays bounded when names are
+// unexpectedly high cardinality.
+type nameCache struct {
+	size int
+
+	mx sync.RWMutex
+	m  map[string]interface{}
+}
+
+// newNameCache returns a nameCache holding at most size names.
+func newNameCache(size int) *nameCache {
+	return &nameCache{
+		size: size,
+		m:    make(map[string]interface{}, size),
+	}
+}
+
+// get returns the value cached for the full stat name prefix.stat. It does
+// not allocate for names up to 128 bytes.
+func (c *nameCache) get(prefix, stat string) (interface{}, bool) {
+	if prefix == "" {
+		c.mx.RLock()
+		v, ok := c.m[stat]
+		c.mx.RUnlock()
+		return v, ok
+	}
+
+	// build the full name on the stack, if it fits
+	var scratch [128]byte
+	name := appendName(scratch[:0], prefix, stat)
+
+	// the string conversion in a map index expression does not allocate
+	c.mx.RLock()
+	v, ok := c.m[string(name)]
+	c.mx.RUnlock()
+	return v, ok
+}
+
+// add caches v for name, unless a value was cached for name in the meantime,
+// and returns the cached value. Concurrent callers adding the same name thus
+// all get the same value.
+func (c *nameCache) add(name string, v interface{}) interface{} {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if cached, ok := c.m[name]; ok {
+		return cached
+	}
+	if len(c.m) >= c.size {
+		for k := range c.m {
+			delete(c.m, k)
+		}
+	}
+	c.m[name] = v
+	return v
+}
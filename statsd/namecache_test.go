@@ -0,0 +1,53 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Run with -race to be meaningful.
+func TestNameCache(t *testing.T) {
+	c := newNameCache(8)
+
+	if _, ok := c.get("test", "one"); ok {
+		t.Fatal("expected an empty cache")
+	}
+	if v := c.add("test.one", 1); v != 1 {
+		t.Fatalf("expected the added value, got %v", v)
+	}
+	// a concurrent add of the same name returns the first value
+	if v := c.add("test.one", 2); v != 1 {
+		t.Fatalf("expected the cached value, got %v", v)
+	}
+	if v, ok := c.get("test", "one"); !ok || v != 1 {
+		t.Fatalf("expected the cached value, got %v", v)
+	}
+	if v, ok := c.get("", "test.one"); !ok || v != 1 {
+		t.Fatalf("expected the cached value without a prefix, got %v", v)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// more names than the cache holds, so that it overflows
+			for j := 0; j < 100; j++ {
+				stat := strconv.Itoa(i) + "." + strconv.Itoa(j%20)
+				if _, ok := c.get("test", stat); !ok {
+					c.add("test."+stat, j)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(c.m) > 8 {
+		t.Fatalf("cache exceeded its bound: %d", len(c.m))
+	}
+}
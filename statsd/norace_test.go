@@ -0,0 +1,10 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !race
+// +build !race
+
+package statsd
+
+const raceEnabled = false
@@ -0,0 +1,55 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the parser, wrapped in an *Error. Use errors.Is to
+// check for them.
+var (
+	ErrEmpty        = errors.New("empty line")
+	ErrSyntax       = errors.New("syntax error")
+	ErrName         = errors.New("invalid name")
+	ErrValue        = errors.New("invalid value")
+	ErrType         = errors.New("invalid type")
+	ErrRate         = errors.New("invalid sample rate")
+	ErrTags         = errors.New("invalid tags")
+	ErrTimestamp    = errors.New("invalid timestamp")
+	ErrField        = errors.New("invalid field")
+	ErrEvent        = errors.New("invalid event")
+	ErrServiceCheck = errors.New("invalid service check")
+)
+
+// maxErrorInput is the length at which the input of an Error is truncated.
+const maxErrorInput = 128
+
+// Error is an error parsing a line.
+type Error struct {
+	// Index is the index of the line in the packet, 0 for ParseLine.
+	Index int
+	// Input is the line, truncated if long.
+	Input string
+	// Err is one of the Err variables of this package.
+	Err error
+}
+
+func newError(index int, line []byte, err error) *Error {
+	if len(line) > maxErrorInput {
+		line = line[:maxErrorInput]
+	}
+	return &Error{Index: index, Input: string(line), Err: err}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Index+1, e.Err, e.Input)
+}
+
+// Unwrap returns Err.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import (
+	"bytes"
+	"strconv"
+)
+
+var (
+	eventPrefix        = []byte("_e{")
+	serviceCheckPrefix = []byte("_sc|")
+)
+
+// parseEvent parses the part of an event line following "_e{", of the form
+// {title length},{text length}}:{title}|{text}[|d:{timestamp}][|h:{hostname}]
+// [|k:{aggregation key}][|p:{priority}][|s:{source type}][|t:{alert type}][|#{tags}]
+func parseEvent(b []byte, l *Line) error {
+	comma := bytes.IndexByte(b, ',')
+	if comma < 0 {
+		return ErrEvent
+	}
+	titleLen, ok := parseLength(b[:comma])
+	if !ok {
+		return ErrEvent
+	}
+	b = b[comma+1:]
+
+	brace := bytes.IndexByte(b, '}')
+	if brace < 0 {
+		return ErrEvent
+	}
+	textLen, ok := parseLength(b[:brace])
+	if !ok {
+		return ErrEvent
+	}
+	b = b[brace+1:]
+
+	// ":" title "|" text
+	if titleLen == 0 || len(b) < titleLen+textLen+2 || b[0] != ':' || b[titleLen+1] != '|' {
+		return ErrEvent
+	}
+	l.Name = b[1 : titleLen+1]
+	l.Text = b[titleLen+2 : titleLen+2+textLen]
+	b = b[titleLen+2+textLen:]
+
+	var rest []byte
+	if len(b) > 0 {
+		if b[0] != '|' {
+			return ErrEvent
+		}
+		rest = b[1:]
+	}
+
+	var seen [256]bool
+	for rest != nil {
+		field := rest
+		if bar := bytes.IndexByte(rest, '|'); bar >= 0 {
+			field, rest = rest[:bar], rest[bar+1:]
+		} else {
+			rest = nil
+		}
+
+		if len(field) == 0 || seen[field[0]] {
+			return ErrField
+		}
+		seen[field[0]] = true
+
+		if field[0] == '#' {
+			if err := parseTags(field[1:], ',', ':', l); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(field) < 2 || field[1] != ':' {
+			return ErrField
+		}
+		v := field[2:]
+		switch field[0] {
+		case 'd':
+			ts, ok := parseTimestamp(v)
+			if !ok {
+				return ErrTimestamp
+			}
+			l.Timestamp = ts
+		case 'h':
+			l.Hostname = v
+		case 'k':
+			l.AggregationKey = v
+		case 'p':
+			if string(v) != "normal" && string(v) != "low" {
+				return ErrEvent
+			}
+			l.Priority = v
+		case 's':
+			l.SourceType = v
+		case 't':
+			switch string(v) {
+			case "error", "warning", "info", "success":
+			default:
+				return ErrEvent
+			}
+			l.AlertType = v
+		default:
+			return ErrField
+		}
+	}
+	return nil
+}
+
+// parseServiceCheck parses the part of a service check line following
+// "_sc|", of the form
+// {name}|{status}[|d:{timestamp}][|h:{hostname}][|#{tags}][|m:{message}]
+// The message, if any, is the last field.
+func parseServiceCheck(b []byte, l *Line) error {
+	bar := bytes.IndexByte(b, '|')
+	if bar <= 0 {
+		return ErrServiceCheck
+	}
+	l.Name = b[:bar]
+	b = b[bar+1:]
+
+	status := b
+	var rest []byte
+	if bar = bytes.IndexByte(b, '|'); bar >= 0 {
+		status, rest = b[:bar], b[bar+1:]
+	}
+	if len(status) != 1 || status[0] < '0' || status[0] > '3' {
+		return ErrServiceCheck
+	}
+	l.Status = ServiceCheckStatus(status[0] - '0')
+
+	var seen [256]bool
+	for rest != nil {
+		field := rest
+		if bar := bytes.IndexByte(rest, '|'); bar >= 0 {
+			field, rest = rest[:bar], rest[bar+1:]
+		} else {
+			rest = nil
+		}
+
+		if len(field) == 0 || seen[field[0]] {
+			return ErrField
+		}
+		seen[field[0]] = true
+
+		if field[0] == '#' {
+			if err := parseTags(field[1:], ',', ':', l); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(field) < 2 || field[1] != ':' {
+			return ErrField
+		}
+		v := field[2:]
+		switch field[0] {
+		case 'd':
+			ts, ok := parseTimestamp(v)
+			if !ok {
+				return ErrTimestamp
+			}
+			l.Timestamp = ts
+		case 'h':
+			l.Hostname = v
+		case 'm':
+			if rest != nil {
+				// the message must be last
+				return ErrServiceCheck
+			}
+			l.Message = v
+		default:
+			return ErrField
+		}
+	}
+	return nil
+}
+
+// parseLength parses the decimal length of an event title or text.
+func parseLength(b []byte) (int, bool) {
+	if len(b) == 0 || len(b) > 9 {
+		return 0, false
+	}
+	for _, c := range b {
+		if !isDigit(c) {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(string(b))
+	return n, err == nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+func TestParseEvent(t *testing.T) {
+	var l Line
+	line := "_e{9,12}:disk|full|hello\\nworld|d:1656581400|h:web1|k:key|p:low|s:src|t:warning|#env:prod,flag"
+	if err := ParseLine([]byte(line), &l); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{
+		"title":     string(l.Name),
+		"text":      string(l.Text),
+		"hostname":  string(l.Hostname),
+		"key":       string(l.AggregationKey),
+		"priority":  string(l.Priority),
+		"source":    string(l.SourceType),
+		"alertType": string(l.AlertType),
+	}
+	want := map[string]string{
+		"title":     "disk|full",
+		"text":      "hello\\nworld",
+		"hostname":  "web1",
+		"key":       "key",
+		"priority":  "low",
+		"source":    "src",
+		"alertType": "warning",
+	}
+	if l.Kind != KindEvent || l.Timestamp != 1656581400 || !reflect.DeepEqual(got, want) {
+		t.Errorf("got kind %d, timestamp %d, %v", l.Kind, l.Timestamp, got)
+	}
+	if tags := l.StatsdTags(); !reflect.DeepEqual(tags, []statsd.Tag{{"env", "prod"}, {"flag", ""}}) {
+		t.Errorf("got tags %v", tags)
+	}
+
+	if err := ParseLine([]byte("_e{1,0}:t|"), &l); err != nil || string(l.Name) != "t" || len(l.Text) != 0 {
+		t.Errorf("empty text: got %q %q %v", l.Name, l.Text, err)
+	}
+}
+
+func TestParseServiceCheck(t *testing.T) {
+	var l Line
+	line := "_sc|db.up|2|d:1656581400|h:db1|#env:prod|m:connection refused"
+	if err := ParseLine([]byte(line), &l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Kind != KindServiceCheck || string(l.Name) != "db.up" || l.Status != StatusCritical ||
+		l.Timestamp != 1656581400 || string(l.Hostname) != "db1" || string(l.Message) != "connection refused" ||
+		len(l.Tags) != 1 {
+		t.Errorf("unexpected service check: %+v", l)
+	}
+}
+
+func TestParseEventErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want error
+	}{
+		{"_e{", ErrEvent},
+		{"_e{1,1}:ab", ErrEvent},
+		{"_e{x,1}:a|b", ErrEvent},
+		{"_e{0,1}:|b", ErrEvent},
+		{"_e{1,1}a|b", ErrEvent},
+		{"_e{1,1}:ab|", ErrEvent},
+		{"_e{1,1}:a|bc", ErrEvent},
+		{"_e{1,1}:a|b|", ErrField},
+		{"_e{1,1}:a|b|x:y", ErrField},
+		{"_e{1,1}:a|b|h:x|h:y", ErrField},
+		{"_e{1,1}:a|b|p:high", ErrEvent},
+		{"_e{1,1}:a|b|t:fatal", ErrEvent},
+		{"_e{1,1}:a|b|d:x", ErrTimestamp},
+		{"_e{1,1}:a|b|#", ErrTags},
+		{"_e{9999999999,1}:a|b", ErrEvent},
+		{"_sc|", ErrServiceCheck},
+		{"_sc||0", ErrServiceCheck},
+		{"_sc|a", ErrServiceCheck},
+		{"_sc|a|4", ErrServiceCheck},
+		{"_sc|a|0|m:msg|h:host", ErrServiceCheck},
+		{"_sc|a|0|x:y", ErrField},
+		{"_sc|a|0|d:0", ErrTimestamp},
+	}
+
+	var l Line
+	for _, tt := range tests {
+		if err := ParseLine([]byte(tt.line), &l); !errors.Is(err, tt.want) {
+			t.Errorf("%q: got error %v, want %v", tt.line, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package parse
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+var fuzzFormats = []statsd.TagFormat{statsd.SuffixOctothorpe, statsd.InfixComma, statsd.InfixSemicolon}
+
+func FuzzParseLine(f *testing.F) {
+	for _, s := range []string{
+		"a.b:1|c",
+		"a:-1.5|g|@0.5|#k:v,flag",
+		"a,k=v:1|ms",
+		"a;k=v:1|h|T1656581400|c:abc",
+		"a:x|s",
+		"_e{5,4}:title|text|d:1|h:h|p:low|t:info|#k:v",
+		"_sc|name|1|d:1|h:h|#k:v|m:msg",
+	} {
+		f.Add([]byte(s), uint8(0))
+	}
+
+	f.Fuzz(func(t *testing.T, line []byte, format uint8) {
+		p := Parser{TagFormat: fuzzFormats[int(format)%len(fuzzFormats)]}
+		var l Line
+		if err := p.ParseLine(line, &l); err != nil {
+			return
+		}
+
+		for _, tag := range l.Tags {
+			if len(tag.Key) == 0 {
+				t.Fatalf("%q: empty tag key", line)
+			}
+		}
+		if l.Kind != KindMetric {
+			return
+		}
+		if len(l.Name) == 0 || l.Type == TypeUnknown || l.Rate <= 0 || l.Rate > 1 {
+			t.Fatalf("%q: invalid metric %+v", line, l)
+		}
+		if l.Type != TypeSet && (math.IsNaN(l.Number) || math.IsInf(l.Number, 0)) {
+			t.Fatalf("%q: non-finite value", line)
+		}
+	})
+}
+
+// recordSender records the packets sent.
+type recordSender struct {
+	mx      sync.Mutex
+	packets [][]byte
+}
+
+func (r *recordSender) Send(data []byte) (int, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.packets = append(r.packets, append([]byte(nil), data...))
+	return len(data), nil
+}
+
+func (r *recordSender) Close() error {
+	return nil
+}
+
+// FuzzClientRoundTrip checks that the lines a sanitizing Client sends are
+// parsed back to the values sent. Inputs the client is not expected to send
+// meaningfully (empty names, tag keys or set members, and non-finite values)
+// are skipped.
+func FuzzClientRoundTrip(f *testing.F) {
+	f.Add("stat", "key", "value", int64(1), 1.5, float32(1), uint8(0), uint8(0))
+	f.Add("a:b|c", "k,k", "v#v", int64(-3), -0.25, float32(0.5), uint8(3), uint8(1))
+	f.Add("a;b=c", "k;k", "v=v", int64(7), 1e21, float32(0.000001), uint8(5), uint8(2))
+	f.Add("set", "key", "a|b\nc", int64(0), 0.0, float32(1), uint8(5), uint8(0))
+	f.Add("stat", "key", "value", int64(1), 0.0, float32(1e-9), uint8(0), uint8(0))
+	f.Add("stat", "key", "value", int64(1), 0.0, float32(0), uint8(0), uint8(0))
+
+	f.Fuzz(func(t *testing.T, name, key, value string, n int64, v float64, rate float32, kind, format uint8) {
+		switch {
+		case name == "" || key == "":
+			return
+		case math.IsNaN(v) || math.IsInf(v, 0):
+			return
+		case value == "":
+			return
+		}
+
+		tf := fuzzFormats[int(format)%len(fuzzFormats)]
+		rs := &recordSender{}
+		st, err := statsd.NewClientWithSender(rs, "", tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := st.(*statsd.Client)
+		if err := c.Reconfigure(&statsd.ClientConfig{TagFormat: tf, Sanitize: statsd.SanitizeReplace}); err != nil {
+			t.Fatal(err)
+		}
+		c.SetSamplerFunc(func(float32) bool { return true })
+
+		tag := statsd.Tag{key, value}
+		var wantType Type
+		var wantNumber float64
+		switch kind % 6 {
+		case 0:
+			err, wantType, wantNumber = c.Inc(name, n, rate, tag), TypeCounter, float64(n)
+		case 1:
+			err, wantType, wantNumber = c.Gauge(name, n, rate, tag), TypeGauge, float64(n)
+		case 2:
+			err, wantType, wantNumber = c.GaugeDelta(name, n, rate, tag), TypeGauge, float64(n)
+		case 3:
+			err, wantType, wantNumber = c.GaugeFloat(name, v, rate, tag), TypeGauge, v
+		case 4:
+			err, wantType, wantNumber = c.Timing(name, n, rate, tag), TypeTiming, float64(n)
+		case 5:
+			err, wantType = c.Set(name, value, rate, tag), TypeSet
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(rate > 0) {
+			// never sent
+			if len(rs.packets) != 0 {
+				t.Fatalf("expected no packet for rate %v, got %q", rate, rs.packets)
+			}
+			return
+		}
+		if len(rs.packets) != 1 {
+			t.Fatalf("expected 1 packet, got %q", rs.packets)
+		}
+		// set members are sanitized
+		member := strings.NewReplacer("|", "_", "\n", "_").Replace(value)
+
+		p := Parser{TagFormat: tf}
+		lines := 0
+		err = p.ParsePacket(rs.packets[0], func(l *Line) {
+			lines++
+			if l.Type != wantType {
+				t.Errorf("got type %s, want %s", l.Type, wantType)
+			}
+			if wantType == TypeSet {
+				if !bytes.Equal(l.Value, []byte(member)) {
+					t.Errorf("got value %q, want %q", l.Value, member)
+				}
+			} else if l.Number != wantNumber {
+				t.Errorf("got value %v, want %v", l.Number, wantNumber)
+			}
+			if rate < 1 && math.Abs(l.Rate-float64(rate)) > 0.000001 {
+				t.Errorf("got rate %v, want %v", l.Rate, rate)
+			}
+			if len(l.Tags) != 1 {
+				t.Errorf("got tags %q, want 1 tag", l.Tags)
+			}
+		})
+		if err != nil {
+			t.Fatalf("%q: %s", rs.packets[0], err)
+		}
+		if lines != 1 {
+			t.Fatalf("%q: got %d lines", rs.packets[0], lines)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import "github.com/cactus/go-statsd-client/v6/statsd"
+
+// Kind is the kind of a Line.
+type Kind uint8
+
+const (
+	// KindMetric is a metric, eg. "name:1|c".
+	KindMetric Kind = iota
+	// KindEvent is a DogStatsD event, eg. "_e{5,4}:title|text".
+	KindEvent
+	// KindServiceCheck is a DogStatsD service check, eg. "_sc|name|0".
+	KindServiceCheck
+)
+
+// Type is the type of a metric.
+type Type uint8
+
+const (
+	// TypeUnknown is the Type of lines that are not metrics.
+	TypeUnknown Type = iota
+	TypeCounter
+	TypeGauge
+	TypeTiming
+	TypeHistogram
+	TypeDistribution
+	TypeSet
+)
+
+// String returns the type tag of t, as used in a metric line.
+func (t Type) String() string {
+	switch t {
+	case TypeCounter:
+		return "c"
+	case TypeGauge:
+		return "g"
+	case TypeTiming:
+		return "ms"
+	case TypeHistogram:
+		return "h"
+	case TypeDistribution:
+		return "d"
+	case TypeSet:
+		return "s"
+	}
+	return ""
+}
+
+// parseType returns the Type of the type tag b.
+func parseType(b []byte) Type {
+	switch string(b) {
+	case "c":
+		return TypeCounter
+	case "g":
+		return TypeGauge
+	case "ms":
+		return TypeTiming
+	case "h":
+		return TypeHistogram
+	case "d":
+		return TypeDistribution
+	case "s":
+		return TypeSet
+	}
+	return TypeUnknown
+}
+
+// ServiceCheckStatus is the status of a service check.
+type ServiceCheckStatus uint8
+
+const (
+	StatusOK ServiceCheckStatus = iota
+	StatusWarning
+	StatusCritical
+	StatusUnknown
+)
+
+// Tag is a tag of a Line. A tag without a value has an empty Value.
+type Tag struct {
+	Key   []byte
+	Value []byte
+}
+
+// Line is a parsed line. Its byte slices point into the parsed input, so
+// they are only valid as long as the input is not modified.
+//
+// Which fields are set depends on the Kind of the line.
+type Line struct {
+	Kind Kind
+
+	// Name is the metric name (without any infix tags), the event title, or
+	// the service check name.
+	Name []byte
+	// Tags are the infix or suffix tags, in order.
+	Tags []Tag
+	// Timestamp is the unix timestamp of the line, or 0 if it has none.
+	Timestamp int64
+	// Hostname is the hostname of an event or service check.
+	Hostname []byte
+
+	// Type is the type of a metric.
+	Type Type
+	// Value is the value of a metric, as sent.
+	Value []byte
+	// Number is the value of a metric of any type but TypeSet.
+	Number float64
+	// Delta is set for a gauge whose value has an explicit sign, which
+	// statsd servers treat as a change to the gauge.
+	Delta bool
+	// Rate is the sample rate of a metric, 1 if it has none.
+	Rate float64
+	// ContainerID is the DogStatsD container id of a metric.
+	ContainerID []byte
+
+	// Text is the text of an event.
+	Text []byte
+	// Priority, AlertType, AggregationKey and SourceType are the optional
+	// fields of an event.
+	Priority       []byte
+	AlertType      []byte
+	AggregationKey []byte
+	SourceType     []byte
+
+	// Status is the status of a service check.
+	Status ServiceCheckStatus
+	// Message is the message of a service check.
+	Message []byte
+}
+
+// reset clears l for parsing another line, keeping the Tags storage.
+func (l *Line) reset() {
+	*l = Line{Tags: l.Tags[:0], Rate: 1}
+}
+
+// StatsdTags returns (copies of) the tags of l as statsd tags.
+func (l *Line) StatsdTags() []statsd.Tag {
+	if len(l.Tags) == 0 {
+		return nil
+	}
+	tags := make([]statsd.Tag, len(l.Tags))
+	for i, t := range l.Tags {
+		tags[i] = statsd.Tag{string(t.Key), string(t.Value)}
+	}
+	return tags
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package parse implements a strict parser of statsd lines, as sent by a
+// statsd.Client, including tags in the statsd.TagFormat dialects, and of
+// DogStatsD metrics, events and service checks.
+//
+// The parser does not allocate for valid lines (once the Tags storage of a
+// reused Line has grown), which makes it suitable for relays and servers.
+package parse
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+// Parser parses lines with tags in a given tag format.
+//
+// The zero value parses suffix tags (statsd.SuffixOctothorpe), which is the
+// default format of a statsd.Client.
+type Parser struct {
+	// TagFormat is the tag format of the lines. Infix tags are parsed if it
+	// includes statsd.InfixComma or statsd.InfixSemicolon, and suffix tags if
+	// it includes statsd.SuffixOctothorpe or is 0. statsd.InfluxLine is not
+	// supported. Events and service checks always use suffix tags.
+	TagFormat statsd.TagFormat
+}
+
+// ParseLine parses a single line (without a line break) into l, with the
+// zero Parser.
+func ParseLine(line []byte, l *Line) error {
+	return Parser{}.ParseLine(line, l)
+}
+
+// ParsePacket parses the lines of a packet with the zero Parser. See
+// Parser.ParsePacket.
+func ParsePacket(packet []byte, fn func(*Line)) error {
+	return Parser{}.ParsePacket(packet, fn)
+}
+
+// ParseLine parses a single line (without a line break) into l, reusing the
+// storage of l.Tags. On error, the returned error is an *Error, and l is
+// invalid.
+func (p Parser) ParseLine(line []byte, l *Line) error {
+	if err := p.parseLine(line, l); err != nil {
+		return newError(0, line, err)
+	}
+	return nil
+}
+
+// ParsePacket parses the newline separated lines of packet, calling fn with
+// each valid line. The Line is reused, so fn must not retain it. A trailing
+// line break is allowed.
+//
+// The errors of invalid lines are returned once all lines are parsed, as a
+// *statsd.MultiError if there are several. Each is an *Error, with the index
+// of the line.
+func (p Parser) ParsePacket(packet []byte, fn func(*Line)) error {
+	var l Line
+	var errs []error
+	for i := 0; len(packet) > 0; i++ {
+		line := packet
+		if n := bytes.IndexByte(packet, '\n'); n >= 0 {
+			line, packet = packet[:n], packet[n+1:]
+		} else {
+			packet = nil
+		}
+
+		if err := p.parseLine(line, &l); err != nil {
+			errs = append(errs, newError(i, line, err))
+			continue
+		}
+		fn(&l)
+	}
+	return statsd.JoinErrors(errs)
+}
+
+func (p Parser) parseLine(line []byte, l *Line) error {
+	l.reset()
+	switch {
+	case len(line) == 0:
+		return ErrEmpty
+	case bytes.IndexByte(line, '\n') >= 0:
+		return ErrSyntax
+	case bytes.HasPrefix(line, eventPrefix):
+		l.Kind = KindEvent
+		return parseEvent(line[len(eventPrefix):], l)
+	case bytes.HasPrefix(line, serviceCheckPrefix):
+		l.Kind = KindServiceCheck
+		return parseServiceCheck(line[len(serviceCheckPrefix):], l)
+	}
+	return p.parseMetric(line, l)
+}
+
+// parseMetric parses a metric line of the form
+// {name}[{infix tags}]:{value}|{type}[|@{rate}][|#{tags}][|c:{container}][|T{timestamp}]
+func (p Parser) parseMetric(line []byte, l *Line) error {
+	colon := bytes.IndexByte(line, ':')
+	if colon < 0 {
+		return ErrSyntax
+	}
+	head, rest := line[:colon], line[colon+1:]
+
+	name := head
+	if sep := p.infixSeparator(); sep != 0 {
+		if i := bytes.IndexByte(head, sep); i >= 0 {
+			name = head[:i]
+			if err := parseTags(head[i+1:], sep, '=', l); err != nil {
+				return err
+			}
+		}
+	}
+	if len(name) == 0 || bytes.IndexByte(name, '|') >= 0 {
+		return ErrName
+	}
+	l.Name = name
+
+	bar := bytes.IndexByte(rest, '|')
+	if bar < 0 {
+		return ErrSyntax
+	}
+	l.Value, rest = rest[:bar], rest[bar+1:]
+
+	typ := rest
+	if bar = bytes.IndexByte(rest, '|'); bar >= 0 {
+		typ, rest = rest[:bar], rest[bar+1:]
+	} else {
+		rest = nil
+	}
+	if l.Type = parseType(typ); l.Type == TypeUnknown {
+		return ErrType
+	}
+
+	if err := parseValue(l); err != nil {
+		return err
+	}
+	return p.parseMetricFields(rest, l)
+}
+
+// infixSeparator returns the separator of infix tags, or 0 if the tag format
+// has none.
+func (p Parser) infixSeparator() byte {
+	switch {
+	case p.TagFormat&statsd.InfixComma != 0:
+		return ','
+	case p.TagFormat&statsd.InfixSemicolon != 0:
+		return ';'
+	}
+	return 0
+}
+
+// suffixTags returns whether the tag format uses suffix tags.
+func (p Parser) suffixTags() bool {
+	return p.TagFormat == 0 || p.TagFormat&statsd.SuffixOctothorpe != 0
+}
+
+// parseValue parses the value of a metric of type l.Type.
+func parseValue(l *Line) error {
+	if l.Type == TypeSet {
+		if len(l.Value) == 0 {
+			return ErrValue
+		}
+		return nil
+	}
+
+	f, ok := parseDecimal(l.Value)
+	if !ok {
+		return ErrValue
+	}
+	l.Number = f
+	l.Delta = l.Type == TypeGauge && (l.Value[0] == '+' || l.Value[0] == '-')
+	return nil
+}
+
+// parseMetricFields parses the optional fields of a metric, each once.
+func (p Parser) parseMetricFields(rest []byte, l *Line) error {
+	var seenRate, seenTags, seenContainer, seenTimestamp bool
+	for rest != nil {
+		field := rest
+		if bar := bytes.IndexByte(rest, '|'); bar >= 0 {
+			field, rest = rest[:bar], rest[bar+1:]
+		} else {
+			rest = nil
+		}
+
+		switch {
+		case len(field) > 0 && field[0] == '@' && !seenRate:
+			seenRate = true
+			f, ok := parseDecimal(field[1:])
+			if !ok || f <= 0 || f > 1 {
+				return ErrRate
+			}
+			l.Rate = f
+		case len(field) > 0 && field[0] == '#' && !seenTags && p.suffixTags():
+			seenTags = true
+			if err := parseTags(field[1:], ',', ':', l); err != nil {
+				return err
+			}
+		case bytes.HasPrefix(field, containerPrefix) && !seenContainer:
+			seenContainer = true
+			l.ContainerID = field[len(containerPrefix):]
+		case len(field) > 0 && field[0] == 'T' && !seenTimestamp:
+			seenTimestamp = true
+			ts, ok := parseTimestamp(field[1:])
+			if !ok {
+				return ErrTimestamp
+			}
+			l.Timestamp = ts
+		default:
+			return ErrField
+		}
+	}
+	return nil
+}
+
+var containerPrefix = []byte("c:")
+
+// parseTags appends the tags of b, separated by sep, to l.Tags. Keys and
+// values are separated by the first kv.
+func parseTags(b []byte, sep, kv byte, l *Line) error {
+	for {
+		t := b
+		i := bytes.IndexByte(b, sep)
+		if i >= 0 {
+			t, b = b[:i], b[i+1:]
+		}
+
+		var tag Tag
+		if j := bytes.IndexByte(t, kv); j >= 0 {
+			tag = Tag{Key: t[:j], Value: t[j+1:]}
+		} else {
+			tag = Tag{Key: t}
+		}
+		if len(tag.Key) == 0 || bytes.IndexByte(t, '|') >= 0 {
+			return ErrTags
+		}
+		l.Tags = append(l.Tags, tag)
+
+		if i < 0 {
+			return nil
+		}
+	}
+}
+
+// parseDecimal parses a finite decimal number, as written by
+// strconv.AppendFloat with the 'f' format or strconv.AppendInt, optionally
+// with an exponent. Unlike strconv.ParseFloat, it rejects hexadecimal
+// numbers, underscores, infinities and NaN.
+func parseDecimal(b []byte) (float64, bool) {
+	i := 0
+	if i < len(b) && (b[i] == '+' || b[i] == '-') {
+		i++
+	}
+	digits := 0
+	for ; i < len(b) && isDigit(b[i]); i++ {
+		digits++
+	}
+	if i < len(b) && b[i] == '.' {
+		for i++; i < len(b) && isDigit(b[i]); i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		start := i
+		for ; i < len(b) && isDigit(b[i]); i++ {
+		}
+		if i == start {
+			return 0, false
+		}
+	}
+	if i != len(b) {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// parseTimestamp parses a positive unix timestamp.
+func parseTimestamp(b []byte) (int64, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	for _, c := range b {
+		if !isDigit(c) {
+			return 0, false
+		}
+	}
+	ts, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || ts <= 0 {
+		return 0, false
+	}
+	return ts, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
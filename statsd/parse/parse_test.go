@@ -0,0 +1,214 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+func tags(kv ...string) []statsd.Tag {
+	var t []statsd.Tag
+	for i := 0; i < len(kv); i += 2 {
+		t = append(t, statsd.Tag{kv[i], kv[i+1]})
+	}
+	return t
+}
+
+// metric is the part of a metric Line compared by the tests.
+type metric struct {
+	Name        string
+	Type        Type
+	Value       string
+	Number      float64
+	Delta       bool
+	Rate        float64
+	Tags        []statsd.Tag
+	Timestamp   int64
+	ContainerID string
+}
+
+func metricOf(l *Line) metric {
+	return metric{
+		Name:        string(l.Name),
+		Type:        l.Type,
+		Value:       string(l.Value),
+		Number:      l.Number,
+		Delta:       l.Delta,
+		Rate:        l.Rate,
+		Timestamp:   l.Timestamp,
+		ContainerID: string(l.ContainerID),
+		Tags:        l.StatsdTags(),
+	}
+}
+
+func TestParseMetric(t *testing.T) {
+	tests := []struct {
+		format statsd.TagFormat
+		line   string
+		want   metric
+	}{
+		{0, "a.b:1|c", metric{Name: "a.b", Type: TypeCounter, Value: "1", Number: 1, Rate: 1}},
+		{0, "a:-1.5|g", metric{Name: "a", Type: TypeGauge, Value: "-1.5", Number: -1.5, Delta: true, Rate: 1}},
+		{0, "a:+2|g", metric{Name: "a", Type: TypeGauge, Value: "+2", Number: 2, Delta: true, Rate: 1}},
+		{0, "a:2|g", metric{Name: "a", Type: TypeGauge, Value: "2", Number: 2, Rate: 1}},
+		{0, "a:1.25|ms|@0.500000", metric{Name: "a", Type: TypeTiming, Value: "1.25", Number: 1.25, Rate: 0.5}},
+		{0, "a:3|h", metric{Name: "a", Type: TypeHistogram, Value: "3", Number: 3, Rate: 1}},
+		{0, "a:1e3|d", metric{Name: "a", Type: TypeDistribution, Value: "1e3", Number: 1000, Rate: 1}},
+		{0, "a:some value|s", metric{Name: "a", Type: TypeSet, Value: "some value", Rate: 1}},
+		{0, "a,b;c:1|c|#k:v,flag,x:y:z", metric{Name: "a,b;c", Type: TypeCounter, Value: "1", Number: 1, Rate: 1,
+			Tags: tags("k", "v", "flag", "", "x", "y:z")}},
+		{0, "a:1|c|#k:v|@0.1|T1656581400|c:abc", metric{Name: "a", Type: TypeCounter, Value: "1", Number: 1, Rate: 0.1,
+			Tags: tags("k", "v"), Timestamp: 1656581400, ContainerID: "abc"}},
+		{statsd.InfixComma, "a,k=v,x=y=z:1|c", metric{Name: "a", Type: TypeCounter, Value: "1", Number: 1, Rate: 1,
+			Tags: tags("k", "v", "x", "y=z")}},
+		{statsd.InfixSemicolon, "a,b;k=v;flag:1|c", metric{Name: "a,b", Type: TypeCounter, Value: "1", Number: 1, Rate: 1,
+			Tags: tags("k", "v", "flag", "")}},
+		{statsd.InfixComma | statsd.SuffixOctothorpe, "a,k=v:1|c|#x:y", metric{Name: "a", Type: TypeCounter, Value: "1", Number: 1, Rate: 1,
+			Tags: tags("k", "v", "x", "y")}},
+	}
+
+	var l Line
+	for _, tt := range tests {
+		p := Parser{TagFormat: tt.format}
+		if err := p.ParseLine([]byte(tt.line), &l); err != nil {
+			t.Errorf("%q: %s", tt.line, err)
+			continue
+		}
+		if l.Kind != KindMetric {
+			t.Errorf("%q: got kind %d", tt.line, l.Kind)
+		}
+		if got := metricOf(&l); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q:\ngot:  %+v\nwant: %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseMetricErrors(t *testing.T) {
+	tests := []struct {
+		format statsd.TagFormat
+		line   string
+		want   error
+	}{
+		{0, "", ErrEmpty},
+		{0, "a:1|c\nb:1|c", ErrSyntax},
+		{0, "a", ErrSyntax},
+		{0, "a:1", ErrSyntax},
+		{0, ":1|c", ErrName},
+		{0, "a|b:1|c", ErrName},
+		{0, "a:1|x", ErrType},
+		{0, "a:1|", ErrType},
+		{0, "a:|c", ErrValue},
+		{0, "a:x|c", ErrValue},
+		{0, "a:NaN|g", ErrValue},
+		{0, "a:+Inf|g", ErrValue},
+		{0, "a:0x10|c", ErrValue},
+		{0, "a:1_000|c", ErrValue},
+		{0, "a:1e|c", ErrValue},
+		{0, "a:1e999|c", ErrValue},
+		{0, "a:.|c", ErrValue},
+		{0, "a:|s", ErrValue},
+		{0, "a:1|c|@0", ErrRate},
+		{0, "a:1|c|@1.5", ErrRate},
+		{0, "a:1|c|@-0.5", ErrRate},
+		{0, "a:1|c|@", ErrRate},
+		{0, "a:1|c|#", ErrTags},
+		{0, "a:1|c|#k:v,", ErrTags},
+		{0, "a:1|c|#:v", ErrTags},
+		{0, "a:1|c|T", ErrTimestamp},
+		{0, "a:1|c|T-1", ErrTimestamp},
+		{0, "a:1|c|T1x", ErrTimestamp},
+		{0, "a:1|c|", ErrField},
+		{0, "a:1|c|@0.5|@0.5", ErrField},
+		{0, "a:1|c|#k:v|#k:v", ErrField},
+		{0, "a:1|c|x", ErrField},
+		{statsd.InfixComma, "a:1|c|#k:v", ErrField},
+		{statsd.InfixComma, "a,:1|c", ErrTags},
+		{statsd.InfixComma, "a,=v:1|c", ErrTags},
+		{statsd.InfixComma, ",k=v:1|c", ErrName},
+		{statsd.InfixSemicolon, "a;k=v;;x=y:1|c", ErrTags},
+	}
+
+	var l Line
+	for _, tt := range tests {
+		p := Parser{TagFormat: tt.format}
+		err := p.ParseLine([]byte(tt.line), &l)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%q: got error %v, want %v", tt.line, err, tt.want)
+			continue
+		}
+		var perr *Error
+		if !errors.As(err, &perr) || perr.Input != tt.line || perr.Index != 0 {
+			t.Errorf("%q: unexpected error %#v", tt.line, err)
+		}
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	packet := []byte("a:1|c\nbad\nb:2|g|#k:v\n:1|c\nc:x|s\n")
+
+	var got []metric
+	err := ParsePacket(packet, func(l *Line) {
+		got = append(got, metricOf(l))
+	})
+
+	want := []metric{
+		{Name: "a", Type: TypeCounter, Value: "1", Number: 1, Rate: 1},
+		{Name: "b", Type: TypeGauge, Value: "2", Number: 2, Rate: 1, Tags: tags("k", "v")},
+		{Name: "c", Type: TypeSet, Value: "x", Rate: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:  %+v\nwant: %+v", got, want)
+	}
+
+	if !errors.Is(err, ErrSyntax) || !errors.Is(err, ErrName) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want2 := "line 2: syntax error: \"bad\"\nline 4: invalid name: \":1|c\""
+	if err.Error() != want2 {
+		t.Errorf("got error %q, want %q", err, want2)
+	}
+
+	if err := ParsePacket([]byte("a:1|c\n\nb:1|c"), func(*Line) {}); !errors.Is(err, ErrEmpty) {
+		t.Errorf("expected an empty line error, got %v", err)
+	}
+	if err := ParsePacket(nil, func(*Line) { t.Error("unexpected line") }); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseLineZeroAllocs(t *testing.T) {
+	var l Line
+	lines := [][]byte{
+		[]byte("some.stat:1.5|ms|@0.500000|#route:/,method:GET"),
+		[]byte("some.gauge:-3|g"),
+		[]byte("_e{5,4}:title|text|#k:v"),
+	}
+	for _, line := range lines {
+		f := func() {
+			if err := ParseLine(line, &l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f()
+		if n := testing.AllocsPerRun(100, f); n != 0 {
+			t.Errorf("%q: got %v allocs, expected 0", line, n)
+		}
+	}
+}
+
+func TestStatsdTags(t *testing.T) {
+	var l Line
+	if err := ParseLine([]byte("a:1|c|#k:v,flag"), &l); err != nil {
+		t.Fatal(err)
+	}
+	want := []statsd.Tag{{"k", "v"}, {"flag", ""}}
+	if got := l.StatsdTags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
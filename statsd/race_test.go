@@ -0,0 +1,13 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build race
+// +build race
+
+package statsd
+
+// raceEnabled reports whether the race detector is enabled. sync.Pool
+// randomly drops items under the race detector, so allocation counts are
+// not meaningful then.
+const raceEnabled = true
@@ -0,0 +1,149 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// defaultRenameCacheSize is the number of cached renames, if not configured.
+const defaultRenameCacheSize = 1024
+
+// RenameRule is a rule renaming full (prefixed) stat names, optionally
+// moving parts of the name into tags. See ClientConfig.RenameRules.
+//
+// For example, the rule
+//
+//	RenameRule{Pattern: "http.*.latency", Name: "http.latency", Tags: []string{"route"}}
+//
+// sends "http.login.latency" as "http.latency", with the tag route:login.
+type RenameRule struct {
+	// Pattern is a glob, where '*' matches a single, non empty, name
+	// component (a sequence of characters other than dots), '**' matches any
+	// number of components, including none (so "a.**.b" also matches "a.b"),
+	// and '?' matches any single character other than a dot, or a regular
+	// expression if Regexp is set. Either must match the whole name.
+	// Globs have the same meaning in FilterRule.Pattern.
+	Pattern string
+	Regexp  bool
+
+	// Name is the new full name. It may refer to the parts matched by the
+	// '*' and '**' wildcards (or regular expression groups) of Pattern, as
+	// $1, $2, etc. (or ${1} when followed by a letter, digit or underscore).
+	// A '**' matching no component expands to "", and adds no tag.
+	Name string
+
+	// Tags are the tag keys for the parts matched by the wildcards (or
+	// regular expression groups) of Pattern, in order. The tags are added
+	// following those of the stat. A key may be "" to not add a tag for the
+	// corresponding wildcard.
+	Tags []string
+}
+
+// renaming is the (cached) result of renaming a stat name.
+type renaming struct {
+	// whether a rule matched
+	ok   bool
+	name string
+	tags []Tag
+}
+
+type renameRule struct {
+	re   *regexp.Regexp
+	name string
+	tags []string
+}
+
+// renamer applies RenameRules to full stat names, caching the results.
+type renamer struct {
+	rules []renameRule
+	// cache of renamings by name
+	cache *nameCache
+}
+
+// newRenamer returns a renamer, or nil if there are no rules.
+func newRenamer(rules []RenameRule, cacheSize int) (*renamer, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	if cacheSize <= 0 {
+		cacheSize = defaultRenameCacheSize
+	}
+
+	r := &renamer{
+		rules: make([]renameRule, len(rules)),
+		cache: newNameCache(cacheSize),
+	}
+	for i, rule := range rules {
+		pattern := rule.Pattern
+		if !rule.Regexp {
+			pattern = globToRegexp(pattern)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid rename pattern %q: %s", rule.Pattern, err)
+		}
+		if len(rule.Tags) > re.NumSubexp() {
+			return nil, fmt.Errorf("rename pattern %q has fewer wildcards than tags", rule.Pattern)
+		}
+		r.rules[i] = renameRule{re: re, name: rule.Name, tags: rule.Tags}
+	}
+	return r, nil
+}
+
+// check returns the renaming for the stat prefix.stat.
+func (r *renamer) check(prefix, stat string) renaming {
+	if rn, ok := r.cache.get(prefix, stat); ok {
+		return rn.(renaming)
+	}
+
+	name := joinName(prefix, stat)
+	return r.cache.add(name, r.run(name)).(renaming)
+}
+
+// run applies the first rule matching name.
+func (r *renamer) run(name string) renaming {
+	for _, rule := range r.rules {
+		m := rule.re.FindStringSubmatchIndex(name)
+		if m == nil {
+			continue
+		}
+
+		rn := renaming{
+			ok:   true,
+			name: string(rule.re.ExpandString(nil, rule.name, name, m)),
+		}
+		for i, key := range rule.tags {
+			if key != "" && m[2*i+2] >= 0 {
+				rn.tags = append(rn.tags, Tag{key, name[m[2*i+2]:m[2*i+3]]})
+			}
+		}
+		return rn
+	}
+	return renaming{}
+}
+
+// rename applies the rename rules to a stat, returning the prefix, stat and
+// tags to write. If the returned pooled slice is not nil, it is to be
+// returned to tagsPool once the tags are no longer used.
+func (s *clientState) rename(prefix, stat string, tags []Tag) (string, string, []Tag, *[]Tag) {
+	if s.renamer == nil {
+		return prefix, stat, tags, nil
+	}
+
+	rn := s.renamer.check(prefix, stat)
+	if !rn.ok {
+		return prefix, stat, tags, nil
+	}
+	if len(rn.tags) == 0 {
+		return "", rn.name, tags, nil
+	}
+
+	tp := tagsPool.Get().(*[]Tag)
+	*tp = append(append((*tp)[:0], tags...), rn.tags...)
+	return "", rn.name, *tp, tp
+}
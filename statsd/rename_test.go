@@ -0,0 +1,142 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenamer(t *testing.T) {
+	r, err := newRenamer([]RenameRule{
+		{Pattern: "http.*.latency", Name: "http.latency", Tags: []string{"route"}},
+		{Pattern: "db.*.*.count", Name: "db.$2.count", Tags: []string{"table", ""}},
+		{Pattern: `queue\.(\w+)_depth`, Regexp: true, Name: "queue.depth", Tags: []string{"queue"}},
+		{Pattern: "legacy.*", Name: "modern.${1}_total"},
+		{Pattern: "jobs.**.v?", Name: "jobs.$1", Tags: []string{"path"}},
+		{Pattern: "api.**.errors", Name: "api.errors", Tags: []string{"path"}},
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renameTests := []struct {
+		Prefix   string
+		Stat     string
+		Expected renaming
+	}{
+		{"", "http.login.latency", renaming{true, "http.latency", []Tag{{"route", "login"}}}},
+		{"http", "login.latency", renaming{true, "http.latency", []Tag{{"route", "login"}}}},
+		{"", "http.login.v2.latency", renaming{}},
+		{"", "http..latency", renaming{}},
+		{"", "db.users.read.count", renaming{true, "db.read.count", []Tag{{"table", "users"}}}},
+		{"", "queue.jobs_depth", renaming{true, "queue.depth", []Tag{{"queue", "jobs"}}}},
+		{"", "legacy.hits", renaming{true, "modern.hits_total", nil}},
+		{"", "legacy.hits.more", renaming{}},
+		{"", "jobs.mail.send.v2", renaming{true, "jobs.mail.send", []Tag{{"path", "mail.send"}}}},
+		{"", "jobs.v22", renaming{}},
+		{"", "api.v1.users.errors", renaming{true, "api.errors", []Tag{{"path", "v1.users"}}}},
+		{"", "api.errors", renaming{true, "api.errors", nil}},
+		{"", "apierrors", renaming{}},
+		{"", "other", renaming{}},
+	}
+
+	// twice, to exercise the cache
+	for i := 0; i < 2; i++ {
+		for _, tt := range renameTests {
+			if got := r.check(tt.Prefix, tt.Stat); !reflect.DeepEqual(got, tt.Expected) {
+				t.Fatalf("%s.%s: got %+v expected %+v", tt.Prefix, tt.Stat, got, tt.Expected)
+			}
+		}
+	}
+	if len(r.cache.m) > 2 {
+		t.Fatalf("cache exceeded its bound: %d", len(r.cache.m))
+	}
+}
+
+func TestRenamerInvalid(t *testing.T) {
+	renameTests := [][]RenameRule{
+		{{Pattern: "(", Regexp: true}},
+		{{Pattern: "http.*", Tags: []string{"one", "two"}}},
+	}
+	for _, rules := range renameTests {
+		if _, err := newRenamer(rules, 0); err == nil {
+			t.Fatalf("expected an error for %+v", rules)
+		}
+	}
+}
+
+func TestClientRenameRules(t *testing.T) {
+	rules := []RenameRule{
+		{Pattern: "test.http.*.latency", Name: "http.latency", Tags: []string{"route"}},
+	}
+
+	for _, tt := range []struct {
+		TagFormat TagFormat
+		Expected  []string
+	}{
+		{SuffixOctothorpe, []string{
+			"http.latency:5|ms|#method:GET,route:login",
+			"http.latency:1|ms|#route:login",
+			"test.other:1|ms",
+		}},
+		{InfixComma, []string{
+			"http.latency,method=GET,route=login:5|ms",
+			"http.latency,route=login:1|ms",
+			"test.other:1|ms",
+		}},
+	} {
+		cs := &captureSender{}
+		st, err := NewClientWithSender(cs, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := st.(*Client)
+		err = c.Reconfigure(&ClientConfig{
+			Prefix:      "test",
+			TagFormat:   tt.TagFormat,
+			RenameRules: rules,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Timing("http.login.latency", 5, 1, Tag{"method", "GET"})
+		c.NewSubStatter("http").(*Client).TimingHandle("login.latency").Timing(1)
+		c.Timing("other", 1, 1)
+
+		if got := cs.take(); !reflect.DeepEqual(got, tt.Expected) {
+			t.Fatalf("got %q expected %q", got, tt.Expected)
+		}
+	}
+}
+
+func TestClientRenameZeroAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful with the race detector")
+	}
+	st, err := NewClientWithSender(&mockSender{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := st.(*Client)
+	err = c.Reconfigure(&ClientConfig{
+		Prefix: "test",
+		RenameRules: []RenameRule{
+			{Pattern: "test.http.*.latency", Name: "http.latency", Tags: []string{"route"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stat := range []string{"http.login.latency", "other"} {
+		f := func() { c.Timing(stat, 1, 1, Tag{"tag1", "val1"}) }
+		f()
+		if n := testing.AllocsPerRun(100, f); n != 0 {
+			t.Errorf("%s: got %v allocs, expected 0", stat, n)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The StatSamplerFunc type defines an extended sampler function, that
+// receives the full stat name (including the prefix, before any RenameRules
+// apply) and tags, along with the rate.
+//
+// Sampler functions must not retain the tags slice.
+type StatSamplerFunc func(stat string, rate float32, tags []Tag) bool
+
+// rateSampler adapts a StatSamplerFunc to a RateSamplerFunc, returning nil
+// for a nil sampler.
+func (f StatSamplerFunc) rateSampler() RateSamplerFunc {
+	if f == nil {
+		return nil
+	}
+	return func(stat string, rate float32, tags []Tag) (float32, bool) {
+		return rate, f(stat, rate, tags)
+	}
+}
+
+// The RateSamplerFunc type defines a sampler function that may also change
+// the sample rate. It returns the rate actually used, which is the rate
+// encoded in the stat, and whether the stat is to be sent.
+//
+// Sampler functions must not retain the tags slice.
+type RateSamplerFunc func(stat string, rate float32, tags []Tag) (float32, bool)
+
+// samplerNamesCacheSize is the number of full stat names cached for sampler
+// functions.
+const samplerNamesCacheSize = 1024
+
+// samplerNames caches the full stat names passed to sampler functions, so
+// that sampling stats of a prefixed Client does not allocate.
+type samplerNames struct {
+	cache *nameCache
+}
+
+func newSamplerNames() *samplerNames {
+	return &samplerNames{cache: newNameCache(samplerNamesCacheSize)}
+}
+
+// get returns the full name of the stat prefix.stat.
+func (n *samplerNames) get(prefix, stat string) string {
+	if prefix == "" {
+		return stat
+	}
+	if n == nil {
+		return joinName(prefix, stat)
+	}
+
+	if full, ok := n.cache.get(prefix, stat); ok {
+		return full.(string)
+	}
+
+	full := joinName(prefix, stat)
+	return n.cache.add(full, full).(string)
+}
+
+// NewKeySampler returns a StatSamplerFunc that samples consistently by the
+// value of the tag named key, so that a given value (eg. a request id) is
+// either always included or always excluded at a given rate. Stats without
+// the tag are sampled with DefaultSampler.
+func NewKeySampler(key string) StatSamplerFunc {
+	return func(stat string, rate float32, tags []Tag) bool {
+		if rate >= 1 {
+			return true
+		}
+		for _, t := range tags {
+			if t[0] == key {
+				return float32(fnv32a(t[1]))/(1<<32) < rate
+			}
+		}
+		return DefaultSampler(rate)
+	}
+}
+
+// fnv32a returns the 32-bit FNV-1a hash of s.
+func fnv32a(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// fastSamplerSeed is used to give each pooled fast sampler state a distinct
+// seed.
+var fastSamplerSeed = uint64(time.Now().UnixNano())
+
+// NewFastSampler returns a StatSamplerFunc backed by a pool of small
+// pseudo-random generators, avoiding the lock shared by the global math/rand
+// source used by DefaultSampler. It is not suitable for anything but
+// sampling.
+func NewFastSampler() StatSamplerFunc {
+	pool := &sync.Pool{New: func() interface{} {
+		state := atomic.AddUint64(&fastSamplerSeed, 0x9e3779b97f4a7c15)
+		return &state
+	}}
+	return func(stat string, rate float32, tags []Tag) bool {
+		if rate >= 1 {
+			return true
+		}
+		state := pool.Get().(*uint64)
+		n := splitmix64(state)
+		pool.Put(state)
+		// use the top 24 bits, the precision of a float32 mantissa
+		return float32(n>>40)/(1<<24) < rate
+	}
+}
+
+// splitmix64 advances state and returns the next pseudo-random value.
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// NewSeededSampler returns a StatSamplerFunc using its own math/rand source
+// seeded with seed, so that the sequence of sampling decisions is
+// deterministic. Useful for tests.
+func NewSeededSampler(seed int64) StatSamplerFunc {
+	var mx sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func(stat string, rate float32, tags []Tag) bool {
+		if rate >= 1 {
+			return true
+		}
+		mx.Lock()
+		f := r.Float32()
+		mx.Unlock()
+		return f < rate
+	}
+}
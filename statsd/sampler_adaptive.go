@@ -0,0 +1,137 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"sync"
+	"time"
+)
+
+// minAdaptiveRate is the lowest rate an AdaptiveSampler will use. It is the
+// smallest rate representable in the "|@rate" suffix.
+const minAdaptiveRate = 0.000001
+
+// adaptiveSamplerSize is the maximum number of stats tracked by an
+// AdaptiveSampler.
+const adaptiveSamplerSize = 10000
+
+// AdaptiveSampler lowers the sample rate of individual stats, so that each
+// stat stays within a budget of lines sent per second. Rates are recomputed
+// once per interval from the traffic seen during the previous interval, so
+// rates go back up again when traffic drops.
+//
+// Stats are tracked by full name (including the prefix), so that the stats
+// of SubStatters with different prefixes have their own budget. At most
+// 10000 names are tracked: past that, tracking starts over. The rate actually
+// used is always encoded in the stat, so server side counts remain correct.
+// A requested rate of 0 is never sampled.
+//
+// Use its Sample method with Client.SetRateSamplerFunc or
+// ClientConfig.RateSampler.
+type AdaptiveSampler struct {
+	budget   float64
+	interval time.Duration
+	sample   StatSamplerFunc
+	clock    Clock
+
+	// tracking state by name
+	stats *nameCache
+}
+
+type adaptiveStat struct {
+	mx sync.Mutex
+	// start of the current interval
+	start time.Time
+	// sum of the requested rates seen in the current interval, ie. the
+	// expected number of lines without adaptive sampling
+	demand float64
+	// multiplier applied to requested rates
+	factor float32
+}
+
+// NewAdaptiveSampler returns a new AdaptiveSampler.
+//
+// budget is the maximum number of lines per second to send for each stat.
+//
+// interval is how often rates are recomputed. If 0, defaults to 1 second.
+func NewAdaptiveSampler(budget float64, interval time.Duration) *AdaptiveSampler {
+	return NewAdaptiveSamplerWithClock(budget, interval, nil)
+}
+
+// NewAdaptiveSamplerWithClock is like NewAdaptiveSampler, but measures
+// intervals with clock (or the system clock, if nil).
+func NewAdaptiveSamplerWithClock(budget float64, interval time.Duration, clock Clock) *AdaptiveSampler {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &AdaptiveSampler{
+		budget:   budget,
+		interval: interval,
+		sample:   NewFastSampler(),
+		clock:    clockOrSystem(clock),
+		stats:    newNameCache(adaptiveSamplerSize),
+	}
+}
+
+// Sample is a RateSamplerFunc. It returns the rate to use for the stat, which
+// is at most the requested rate, and whether the stat is to be sent.
+func (a *AdaptiveSampler) Sample(stat string, rate float32, tags []Tag) (float32, bool) {
+	if !(rate > 0) {
+		return 0, false
+	}
+	if rate > 1 {
+		rate = 1
+	}
+
+	st := a.stat(stat)
+	now := a.clock.Now()
+
+	st.mx.Lock()
+	if elapsed := now.Sub(st.start); elapsed >= a.interval {
+		st.factor = 1
+		if demand := st.demand / elapsed.Seconds(); demand > a.budget {
+			st.factor = float32(a.budget / demand)
+		}
+		st.start = now
+		st.demand = 0
+	}
+	st.demand += float64(rate)
+	factor := st.factor
+	st.mx.Unlock()
+
+	rate *= factor
+	if rate >= 1 {
+		return 1, true
+	}
+	if rate < minAdaptiveRate {
+		rate = minAdaptiveRate
+	}
+	return rate, a.sample(stat, rate, tags)
+}
+
+// Rate returns the multiplier currently applied to the requested rate of
+// stat, a full stat name. It is 1 for stats within budget, or not yet seen.
+func (a *AdaptiveSampler) Rate(stat string) float32 {
+	v, ok := a.stats.get("", stat)
+	if !ok {
+		return 1
+	}
+
+	st := v.(*adaptiveStat)
+	st.mx.Lock()
+	defer st.mx.Unlock()
+	return st.factor
+}
+
+// stat returns the tracking state of stat, creating it if needed.
+func (a *AdaptiveSampler) stat(stat string) *adaptiveStat {
+	if st, ok := a.stats.get("", stat); ok {
+		return st.(*adaptiveStat)
+	}
+
+	st := &adaptiveStat{start: a.clock.Now(), factor: 1}
+	return a.stats.add(stat, st).(*adaptiveStat)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveSampler(t *testing.T) {
+	interval := 20 * time.Millisecond
+	clock := newManualClock()
+	a := NewAdaptiveSamplerWithClock(100, interval, clock)
+
+	for i := 0; i < 1000; i++ {
+		rate, ok := a.Sample("busy", 1, nil)
+		if rate != 1 || !ok {
+			t.Fatalf("expected first interval to be unsampled, got %f %t", rate, ok)
+		}
+	}
+	if rate, _ := a.Sample("quiet", 1, nil); rate != 1 {
+		t.Fatalf("expected quiet stat to be unsampled, got %f", rate)
+	}
+
+	clock.advance(interval)
+
+	// 1000 lines in 20ms is 50000 lines/s, for a budget of 100 lines/s
+	rate, _ := a.Sample("busy", 1, nil)
+	if rate != 0.002 || rate != a.Rate("busy") {
+		t.Fatalf("expected a lowered rate, got %f (factor %f)", rate, a.Rate("busy"))
+	}
+	if rate, _ := a.Sample("quiet", 1, nil); rate != 1 {
+		t.Fatalf("expected quiet stat to be unsampled, got %f", rate)
+	}
+
+	// requested rates are scaled, not replaced
+	half, _ := a.Sample("busy", 0.5, nil)
+	if half != rate/2 {
+		t.Fatalf("expected half the adaptive rate, got %f", half)
+	}
+
+	// traffic drops, so the rate goes back up
+	clock.advance(interval)
+	if rate, _ := a.Sample("busy", 1, nil); rate != 1 {
+		t.Fatalf("expected rate to recover, got %f", rate)
+	}
+}
+
+func TestAdaptiveSamplerZeroRate(t *testing.T) {
+	a := NewAdaptiveSamplerWithClock(100, time.Second, newManualClock())
+	if rate, ok := a.Sample("stat", 0, nil); rate != 0 || ok {
+		t.Fatalf("expected a rate of 0 to never be sampled, got %f %t", rate, ok)
+	}
+}
+
+func TestAdaptiveSamplerSize(t *testing.T) {
+	a := NewAdaptiveSamplerWithClock(100, time.Second, newManualClock())
+	for i := 0; i < adaptiveSamplerSize+10; i++ {
+		a.Sample(strconv.Itoa(i), 1, nil)
+	}
+	if len(a.stats.m) > adaptiveSamplerSize {
+		t.Fatalf("expected at most %d tracked stats, got %d", adaptiveSamplerSize, len(a.stats.m))
+	}
+}
+
+func TestAdaptiveSamplerPrefix(t *testing.T) {
+	interval := 20 * time.Millisecond
+	clock := newManualClock()
+	a := NewAdaptiveSamplerWithClock(100, interval, clock)
+
+	c, err := newClientFromConfig(&mockSender{}, &ClientConfig{RateSampler: a.Sample})
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy := c.NewSubStatter("busy")
+	quiet := c.NewSubStatter("quiet")
+
+	for i := 0; i < 1000; i++ {
+		busy.Inc("count", 1, 1)
+	}
+	quiet.Inc("count", 1, 1)
+	clock.advance(interval)
+	busy.Inc("count", 1, 1)
+	quiet.Inc("count", 1, 1)
+
+	if rate := a.Rate("busy.count"); rate != 0.002 {
+		t.Fatalf("expected a lowered rate, got %f", rate)
+	}
+	if rate := a.Rate("quiet.count"); rate != 1 {
+		t.Fatalf("expected quiet stat to be unsampled, got %f", rate)
+	}
+}
+
+func TestClientRateSampler(t *testing.T) {
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	config := &ClientConfig{
+		Address: l.LocalAddr().String(),
+		Prefix:  "test",
+		RateSampler: func(stat string, rate float32, tags []Tag) (float32, bool) {
+			return rate / 4, true
+		},
+	}
+	c, err := NewClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Inc("count", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 128)
+	_, _, err = l.ReadFrom(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = bytes.TrimRight(data, "\x00")
+	expected := "test.count:1|c|@0.250000"
+	if !bytes.Equal(data, []byte(expected)) {
+		t.Fatalf("got '%s' expected '%s'", data, expected)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestKeySampler(t *testing.T) {
+	sampler := NewKeySampler("request_id")
+
+	included := 0
+	for i := 0; i < 1000; i++ {
+		tags := []Tag{{"route", "/"}, {"request_id", fmt.Sprintf("req-%d", i)}}
+		first := sampler("timing", 0.5, tags)
+		for j := 0; j < 3; j++ {
+			if sampler("other", 0.5, tags) != first {
+				t.Fatalf("inconsistent sampling for %v", tags)
+			}
+		}
+		if first {
+			included++
+		}
+	}
+	if included < 400 || included > 600 {
+		t.Fatalf("expected about half to be included, got %d/1000", included)
+	}
+
+	if !sampler("timing", 1, []Tag{{"request_id", "x"}}) {
+		t.Fatal("rate 1 should always be included")
+	}
+}
+
+func TestSeededSampler(t *testing.T) {
+	a := NewSeededSampler(42)
+	b := NewSeededSampler(42)
+	for i := 0; i < 100; i++ {
+		if a("stat", 0.5, nil) != b("stat", 0.5, nil) {
+			t.Fatal("expected identical sequences for identical seeds")
+		}
+	}
+}
+
+func TestFastSampler(t *testing.T) {
+	sampler := NewFastSampler()
+	included := 0
+	for i := 0; i < 10000; i++ {
+		if sampler("stat", 0.25, nil) {
+			included++
+		}
+	}
+	if included < 2000 || included > 3000 {
+		t.Fatalf("expected about a quarter to be included, got %d/10000", included)
+	}
+	if sampler("stat", 0, nil) {
+		t.Fatal("rate 0 should never be included")
+	}
+}
+
+func TestClientStatSampler(t *testing.T) {
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var gotStat string
+	var gotTags []Tag
+	config := &ClientConfig{
+		Address: l.LocalAddr().String(),
+		Prefix:  "test",
+		Sampler: func(stat string, rate float32, tags []Tag) bool {
+			gotStat = stat
+			gotTags = append(gotTags[:0], tags...)
+			return tags[0][1] == "yes"
+		},
+	}
+	c, err := NewClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Inc("count", 1, 0.5, Tag{"sample", "no"})
+	c.Inc("count", 1, 0.5, Tag{"sample", "yes"})
+	if gotStat != "test.count" || len(gotTags) != 1 || gotTags[0][0] != "sample" {
+		t.Fatalf("sampler called with unexpected args: %s %v", gotStat, gotTags)
+	}
+
+	data := make([]byte, 128)
+	_, _, err = l.ReadFrom(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = bytes.TrimRight(data, "\x00")
+	expected := "test.count:1|c|@0.500000|#sample:yes"
+	if !bytes.Equal(data, []byte(expected)) {
+		t.Fatalf("got '%s' expected '%s'", data, expected)
+	}
+}
+
+func TestClientSampleRates(t *testing.T) {
+	cs := &captureSender{}
+	c, err := NewClientWithSender(cs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*Client).SetSamplerFunc(func(float32) bool { return true })
+
+	c.Inc("count", 1, 0.000001)
+	// too small for 6 decimals
+	c.Inc("count", 1, 0.0000001)
+	// a stat with a rate of 0 is never sent
+	c.Inc("count", 1, 0)
+	c.Inc("count", 1, -1)
+
+	expected := []string{
+		"test.count:1|c|@0.000001",
+		"test.count:1|c|@0.0000001",
+	}
+	if got := cs.take(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q expected %q", got, expected)
+	}
+}
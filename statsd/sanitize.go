@@ -0,0 +1,160 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SanitizeMode determines how a Client handles stat names, tag keys, tag
+// values, set members and raw values that contain characters reserved by the
+// configured TagFormat.
+type SanitizeMode uint8
+
+const (
+	// SanitizeNone writes stat names and tags verbatim. This is the default.
+	SanitizeNone SanitizeMode = iota
+	// SanitizeReplace replaces each reserved character with an underscore.
+	SanitizeReplace
+	// SanitizeReject refuses to send the stat, returning an error instead.
+	SanitizeReject
+)
+
+// sanitizeReplacement is the byte used in place of reserved characters by
+// SanitizeReplace.
+const sanitizeReplacement = '_'
+
+// sanitizer checks (and possibly rewrites) stat names and tags against the
+// characters reserved by a given TagFormat.
+type sanitizer struct {
+	mode SanitizeMode
+	// reserved characters in stat names and prefixes
+	name [256]bool
+	// reserved characters in tag keys and tag values
+	tag [256]bool
+	// reserved characters in set members
+	member [256]bool
+	// reserved characters in raw values, which hold the rest of the line
+	raw [256]bool
+}
+
+// newSanitizer returns a sanitizer for the supplied mode and TagFormat, or
+// nil if mode is SanitizeNone.
+func newSanitizer(mode SanitizeMode, tf TagFormat) *sanitizer {
+	if mode == SanitizeNone {
+		return nil
+	}
+
+	z := &sanitizer{mode: mode}
+	var name, tag, member string
+	switch {
+	case tf&InfluxLine != 0:
+		// commas, spaces, equals signs and quotes are escaped by the line
+		// protocol writer, but there is no escaping a line break.
+		name = "\n"
+		tag = "\n"
+		member = "\n"
+	case tf&InfixComma != 0:
+		name = ":|,=\n"
+		tag = ":|,=\n"
+		member = "|\n"
+	case tf&InfixSemicolon != 0:
+		name = ":|;=\n"
+		tag = ":|;=\n"
+		member = "|\n"
+	default:
+		name = ":|\n"
+		tag = ":|,#\n"
+		member = "|\n"
+	}
+	reserve(&z.name, name)
+	reserve(&z.tag, tag)
+	reserve(&z.member, member)
+	reserve(&z.raw, "\n")
+	return z
+}
+
+// reserve marks the characters of chars as reserved in table.
+func reserve(table *[256]bool, chars string) {
+	for i := 0; i < len(chars); i++ {
+		table[chars[i]] = true
+	}
+}
+
+// apply checks prefix, stat and tags, returning them unchanged when they are
+// clean. Otherwise they are either rewritten, or an error is returned,
+// depending on the sanitizer mode. Only rewritten values are allocated.
+func (z *sanitizer) apply(prefix, stat string, tags []Tag) (string, string, []Tag, error) {
+	var err error
+	if prefix, err = z.string(prefix, &z.name, "stat prefix"); err != nil {
+		return prefix, stat, tags, err
+	}
+	if stat, err = z.string(stat, &z.name, "stat name"); err != nil {
+		return prefix, stat, tags, err
+	}
+
+	var clean []Tag
+	for i, t := range tags {
+		k, err := z.string(t[0], &z.tag, "tag key")
+		if err != nil {
+			return prefix, stat, tags, err
+		}
+		v, err := z.string(t[1], &z.tag, "tag value")
+		if err != nil {
+			return prefix, stat, tags, err
+		}
+		if clean == nil && (k != t[0] || v != t[1]) {
+			// first dirty tag, so copy before rewriting
+			clean = make([]Tag, len(tags))
+			copy(clean, tags)
+		}
+		if clean != nil {
+			clean[i] = Tag{k, v}
+		}
+	}
+	if clean != nil {
+		tags = clean
+	}
+	return prefix, stat, tags, nil
+}
+
+// value checks the value of a set or raw stat, returning it unchanged when it
+// is clean.
+func (z *sanitizer) value(v string, kind statType) (string, error) {
+	if kind == statRaw {
+		return z.string(v, &z.raw, "raw value")
+	}
+	return z.string(v, &z.member, "set member")
+}
+
+// string sanitizes a single string against the reserved table.
+func (z *sanitizer) string(s string, reserved *[256]bool, what string) (string, error) {
+	i := 0
+	for ; i < len(s); i++ {
+		if reserved[s[i]] {
+			break
+		}
+	}
+	if i == len(s) {
+		return s, nil
+	}
+
+	if z.mode == SanitizeReject {
+		return s, fmt.Errorf("invalid character %q in %s: %q", s[i], what, s)
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s[:i])
+	for ; i < len(s); i++ {
+		if reserved[s[i]] {
+			b.WriteByte(sanitizeReplacement)
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
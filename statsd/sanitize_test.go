@@ -0,0 +1,176 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestClientSanitize(t *testing.T) {
+	sanitizeTests := []struct {
+		Mode      SanitizeMode
+		TagFormat TagFormat
+		Prefix    string
+		Stat      string
+		Tags      []Tag
+		Expected  string
+		Err       bool
+	}{
+		{
+			SanitizeNone, SuffixOctothorpe, "test", "co:unt",
+			[]Tag{{"tag1", "va|l1"}},
+			"test.co:unt:1|c|#tag1:va|l1", false,
+		},
+		{
+			SanitizeReplace, SuffixOctothorpe, "test", "count",
+			[]Tag{{"tag1", "val1"}},
+			"test.count:1|c|#tag1:val1", false,
+		},
+		{
+			SanitizeReplace, SuffixOctothorpe, "te|st", "co:unt\nx:1|c",
+			[]Tag{{"t#ag1", "va,l1"}, {"tag2", "v|al:2"}},
+			"te_st.co_unt_x_1_c:1|c|#t_ag1:va_l1,tag2:v_al_2", false,
+		},
+		{
+			SanitizeReplace, InfixComma, "test", "co,unt",
+			[]Tag{{"ta=g1", "val,1"}},
+			"test.co_unt,ta_g1=val_1:1|c", false,
+		},
+		{
+			SanitizeReplace, InfixSemicolon, "test", "co;unt",
+			[]Tag{{"ta=g1", "val;1"}},
+			"test.co_unt;ta_g1=val_1:1|c", false,
+		},
+		{
+			SanitizeReplace, InfluxLine, "test", "co unt\n",
+			[]Tag{{"tag1", "val\n1"}},
+			`test.co\ unt_,tag1=val_1 count=1i 0`, false,
+		},
+		{
+			SanitizeReject, SuffixOctothorpe, "test", "count",
+			[]Tag{{"tag1", "val1"}},
+			"test.count:1|c|#tag1:val1", false,
+		},
+		{
+			SanitizeReject, SuffixOctothorpe, "test", "co:unt",
+			nil, "", true,
+		},
+		{
+			SanitizeReject, SuffixOctothorpe, "test", "count",
+			[]Tag{{"tag1", "val,1"}}, "", true,
+		},
+	}
+
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, tt := range sanitizeTests {
+		config := &ClientConfig{
+			Address:   l.LocalAddr().String(),
+			Prefix:    tt.Prefix,
+			TagFormat: tt.TagFormat,
+			Sanitize:  tt.Mode,
+			// InfluxLine timestamps are 0
+			Clock: newManualClock(),
+		}
+
+		c, err := NewClientWithConfig(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.Inc(tt.Stat, 1, 1.0, tt.Tags...)
+		if tt.Err {
+			c.Close()
+			if err == nil {
+				t.Fatalf("%q expected an error", tt.Stat)
+			}
+			continue
+		}
+		if err != nil {
+			c.Close()
+			t.Fatal(err)
+		}
+
+		data := make([]byte, 128)
+		_, _, err = l.ReadFrom(data)
+		if err != nil {
+			c.Close()
+			t.Fatal(err)
+		}
+
+		data = bytes.TrimRight(data, "\x00")
+		if !bytes.Equal(data, []byte(tt.Expected)) {
+			c.Close()
+			t.Fatalf("got '%s' expected '%s'", data, tt.Expected)
+		}
+		c.Close()
+	}
+}
+
+func TestSanitizerCleanTagsNotCopied(t *testing.T) {
+	z := newSanitizer(SanitizeReplace, SuffixOctothorpe)
+	tags := []Tag{{"tag1", "val1"}}
+	_, _, got, err := z.apply("test", "count", tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &got[0] != &tags[0] {
+		t.Fatal("expected clean tags to be returned as is")
+	}
+}
+
+func TestClientSanitizeValues(t *testing.T) {
+	var sanitizeValueTests = []struct {
+		Mode      SanitizeMode
+		TagFormat TagFormat
+		Method    string
+		Value     string
+		Expected  string
+		Err       bool
+	}{
+		{SanitizeReplace, SuffixOctothorpe, "Set", "a|b\nc", "test.set:a_b_c|s", false},
+		{SanitizeReplace, InfixComma, "Set", "a:b,c", "test.set:a:b,c|s", false},
+		{SanitizeReplace, SuffixOctothorpe, "Raw", "1|c\n", "test.raw:1|c_", false},
+		{SanitizeReplace, InfluxLine, "Set", "a b\n", `test.set set="a b_" 0`, false},
+		{SanitizeReject, SuffixOctothorpe, "Set", "a|b", "", true},
+		{SanitizeReject, SuffixOctothorpe, "Raw", "1|c\n", "", true},
+		{SanitizeNone, SuffixOctothorpe, "Set", "a|b", "test.set:a|b|s", false},
+	}
+
+	for _, tt := range sanitizeValueTests {
+		cs := &captureSender{}
+		c, err := newClientFromConfig(cs, &ClientConfig{
+			Prefix:    "test",
+			TagFormat: tt.TagFormat,
+			Sanitize:  tt.Mode,
+			Clock:     newManualClock(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tt.Method == "Set" {
+			err = c.Set("set", tt.Value, 1)
+		} else {
+			err = c.Raw("raw", tt.Value, 1)
+		}
+		if tt.Err {
+			if err == nil {
+				t.Fatalf("%s %q: expected an error", tt.Method, tt.Value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cs.take(); len(got) != 1 || got[0] != tt.Expected {
+			t.Fatalf("%s %q: got %q expected '%s'", tt.Method, tt.Value, got, tt.Expected)
+		}
+	}
+}
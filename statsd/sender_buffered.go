@@ -22,11 +22,14 @@ type BufferedSender struct {
 	// buffers
 	bufmx  sync.Mutex
 	buffer *bytes.Buffer
-	bufs   chan *bytes.Buffer
+	bufs   chan queued
 	// lifecycle
 	runmx    sync.RWMutex
 	shutdown chan chan error
+	flushes  chan chan error
 	running  bool
+	// source of flush ticks, the system clock if nil
+	clock Clock
 }
 
 // Send bytes.
@@ -76,6 +79,28 @@ func (s *BufferedSender) Close() error {
 	return <-errChan
 }
 
+// queued is an item of the send queue of a BufferedSender: either a buffer to
+// send, or a flush request, acked once the buffers queued before it are sent.
+type queued struct {
+	buf *bytes.Buffer
+	ack chan error
+}
+
+// Flush sends any buffered stats right away, instead of waiting for the next
+// flush interval. It returns once all stats buffered before the call are
+// sent, with the first error sending them since the previous Flush, if any.
+func (s *BufferedSender) Flush() error {
+	s.runmx.RLock()
+	defer s.runmx.RUnlock()
+	if !s.running {
+		return nil
+	}
+
+	ack := make(chan error, 1)
+	s.flushes <- ack
+	return <-ack
+}
+
 // Start Buffered Sender
 // Begins ticker and read loop
 func (s *BufferedSender) Start() {
@@ -87,8 +112,10 @@ func (s *BufferedSender) Start() {
 	}
 
 	s.running = true
-	s.bufs = make(chan *bytes.Buffer, 32)
-	go s.run()
+	s.bufs = make(chan queued, 32)
+	s.flushes = make(chan chan error)
+	ticker := clockOrSystem(s.clock).NewTicker(s.flushInterval)
+	go s.run(ticker)
 }
 
 func (s *BufferedSender) withBufferLock(fn func()) {
@@ -111,28 +138,41 @@ func (s *BufferedSender) swapnqueue() {
 	ob := s.buffer
 	nb := senderPool.Get()
 	s.buffer = nb
-	s.bufs <- ob
+	s.bufs <- queued{buf: ob}
 }
 
-func (s *BufferedSender) run() {
-	ticker := time.NewTicker(s.flushInterval)
+func (s *BufferedSender) run(ticker Ticker) {
 	defer ticker.Stop()
 
 	doneChan := make(chan bool)
 	go func() {
-		for buf := range s.bufs {
-			s.flush(buf)
-			senderPool.Put(buf)
+		// first error since the last flush request
+		var flushErr error
+		for q := range s.bufs {
+			if q.ack != nil {
+				q.ack <- flushErr
+				flushErr = nil
+				continue
+			}
+			if _, err := s.flush(q.buf); err != nil && flushErr == nil {
+				flushErr = err
+			}
+			senderPool.Put(q.buf)
 		}
 		doneChan <- true
 	}()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			s.withBufferLock(func() {
 				s.swapnqueue()
 			})
+		case ack := <-s.flushes:
+			s.withBufferLock(func() {
+				s.swapnqueue()
+			})
+			s.bufs <- queued{ack: ack}
 		case errChan := <-s.shutdown:
 			s.withBufferLock(func() {
 				s.swapnqueue()
@@ -191,6 +231,11 @@ func NewBufferedSender(addr string, flushInterval time.Duration, flushBytes int)
 // a metric would result in a larger packet than flushBytes, the packet will
 // first be send, then the new data will be added to the next packet.
 func NewBufferedSenderWithSender(sender Sender, flushInterval time.Duration, flushBytes int) (Sender, error) {
+	return newBufferedSender(sender, flushInterval, flushBytes, nil)
+}
+
+// newBufferedSender returns a new BufferedSender, flushing on ticks of clock.
+func newBufferedSender(sender Sender, flushInterval time.Duration, flushBytes int, clock Clock) (Sender, error) {
 	if sender == nil {
 		return nil, fmt.Errorf("sender may not be nil")
 	}
@@ -201,6 +246,7 @@ func NewBufferedSenderWithSender(sender Sender, flushInterval time.Duration, flu
 		sender:        sender,
 		buffer:        senderPool.Get(),
 		shutdown:      make(chan chan error),
+		clock:         clock,
 	}
 
 	bufSender.Start()
@@ -114,3 +114,75 @@ func TestCloseDuringSendConcurrent(t *testing.T) {
 		t.Errorf("expected close to have been called once, but got %d", mockSender.closeCallCount)
 	}
 }
+
+func TestFlush(t *testing.T) {
+	cs := &captureSender{}
+	sender, err := NewBufferedSenderWithSender(cs, time.Hour, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	bs := sender.(*BufferedSender)
+
+	if err := bs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cs.take(); len(got) != 0 {
+		t.Fatalf("expected nothing sent, got %q", got)
+	}
+
+	bs.Send([]byte("stat:1|c"))
+	bs.Send([]byte("stat:2|c"))
+	if err := bs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cs.take(); len(got) != 1 || got[0] != "stat:1|c\nstat:2|c" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestFlushQueued(t *testing.T) {
+	cs := &captureSender{}
+	// each stat fills a buffer, so every Send queues one
+	sender, err := NewBufferedSenderWithSender(cs, time.Hour, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	bs := sender.(*BufferedSender)
+
+	for _, stat := range []string{"stat:1|c", "stat:2|c", "stat:3|c"} {
+		bs.Send([]byte(stat))
+	}
+	if err := bs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got := cs.take()
+	want := []string{"stat:1|c", "stat:2|c", "stat:3|c"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFlushError(t *testing.T) {
+	sender, err := NewBufferedSenderWithSender(errSender{}, time.Hour, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	bs := sender.(*BufferedSender)
+
+	bs.Send([]byte("stat:1|c"))
+	if err := bs.Flush(); err == nil {
+		t.Fatal("expected an error")
+	}
+	// the error is only reported once
+	if err := bs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
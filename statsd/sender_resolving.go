@@ -27,6 +27,8 @@ type ResolvingSimpleSender struct {
 	mx       sync.RWMutex
 	doneChan chan struct{}
 	running  bool
+	// source of re-resolve ticks, the system clock if nil
+	clock Clock
 }
 
 // Send sends the data to the server endpoint.
@@ -132,18 +134,18 @@ func (s *ResolvingSimpleSender) Start() {
 	}
 
 	s.running = true
-	go s.run()
+	ticker := clockOrSystem(s.clock).NewTicker(s.reresolveInterval)
+	go s.run(ticker)
 }
 
-func (s *ResolvingSimpleSender) run() {
-	ticker := time.NewTicker(s.reresolveInterval)
+func (s *ResolvingSimpleSender) run(ticker Ticker) {
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-s.doneChan:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			// reconnect locks/checks running, so no need to do it here
 			s.Reconnect()
 		}
@@ -156,6 +158,12 @@ func (s *ResolvingSimpleSender) run() {
 // addr is a string of the format "hostname:port", and must be parsable by
 // net.ResolveUDPAddr.
 func NewResolvingSimpleSender(addr string, interval time.Duration) (Sender, error) {
+	return newResolvingSimpleSender(addr, interval, nil)
+}
+
+// newResolvingSimpleSender returns a new ResolvingSimpleSender, re-resolving
+// on ticks of clock.
+func newResolvingSimpleSender(addr string, interval time.Duration, clock Clock) (Sender, error) {
 	conn, err := net.ListenPacket("udp", ":0")
 	if err != nil {
 		return nil, err
@@ -174,6 +182,7 @@ func NewResolvingSimpleSender(addr string, interval time.Duration) (Sender, erro
 		reresolveInterval: interval,
 		doneChan:          make(chan struct{}),
 		running:           false,
+		clock:             clock,
 	}
 
 	sender.Start()
@@ -0,0 +1,277 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+	"github.com/cactus/go-statsd-client/v6/statsd/parse"
+)
+
+// aggregator aggregates metrics with the semantics of the Etsy statsd
+// daemon. It is not safe for concurrent use.
+type aggregator struct {
+	percentiles  []float64
+	deleteGauges bool
+
+	counters map[string]*counterState
+	gauges   map[string]*gaugeState
+	sets     map[string]*setState
+	timers   map[string]*timerState
+
+	lines    int
+	badLines int
+
+	// scratch space for series keys
+	key  []byte
+	tags []parse.Tag
+}
+
+type counterState struct {
+	series Series
+	value  float64
+}
+
+type gaugeState struct {
+	series Series
+	value  float64
+}
+
+type setState struct {
+	series  Series
+	members map[string]struct{}
+}
+
+type timerState struct {
+	series Series
+	count  float64
+	values []float64
+}
+
+func newAggregator(percentiles []float64, deleteGauges bool) *aggregator {
+	return &aggregator{
+		percentiles:  percentiles,
+		deleteGauges: deleteGauges,
+		counters:     make(map[string]*counterState),
+		gauges:       make(map[string]*gaugeState),
+		sets:         make(map[string]*setState),
+		timers:       make(map[string]*timerState),
+	}
+}
+
+// add aggregates a parsed line. Events and service checks are ignored.
+func (a *aggregator) add(l *parse.Line) {
+	a.lines++
+	if l.Kind != parse.KindMetric {
+		return
+	}
+
+	key := a.seriesKey(l)
+	switch l.Type {
+	case parse.TypeCounter:
+		c, ok := a.counters[string(key)]
+		if !ok {
+			c = &counterState{series: newSeries(l, a.tags)}
+			a.counters[string(key)] = c
+		}
+		c.value += l.Number / l.Rate
+	case parse.TypeGauge:
+		g, ok := a.gauges[string(key)]
+		if !ok {
+			g = &gaugeState{series: newSeries(l, a.tags)}
+			a.gauges[string(key)] = g
+		}
+		if l.Delta {
+			g.value += l.Number
+		} else {
+			g.value = l.Number
+		}
+	case parse.TypeSet:
+		s, ok := a.sets[string(key)]
+		if !ok {
+			s = &setState{series: newSeries(l, a.tags), members: make(map[string]struct{})}
+			a.sets[string(key)] = s
+		}
+		if _, ok := s.members[string(l.Value)]; !ok {
+			s.members[string(l.Value)] = struct{}{}
+		}
+	case parse.TypeTiming, parse.TypeHistogram, parse.TypeDistribution:
+		t, ok := a.timers[string(key)]
+		if !ok {
+			t = &timerState{series: newSeries(l, a.tags)}
+			a.timers[string(key)] = t
+		}
+		t.count += 1 / l.Rate
+		t.values = append(t.values, l.Number)
+	}
+}
+
+// seriesKey returns the key of the series of l, and leaves its sorted tags in
+// a.tags. The key is only valid until the next call.
+func (a *aggregator) seriesKey(l *parse.Line) []byte {
+	// insertion sort, as there are few tags
+	a.tags = append(a.tags[:0], l.Tags...)
+	for i := 1; i < len(a.tags); i++ {
+		for j := i; j > 0 && tagLess(a.tags[j], a.tags[j-1]); j-- {
+			a.tags[j], a.tags[j-1] = a.tags[j-1], a.tags[j]
+		}
+	}
+
+	a.key = append(a.key[:0], l.Name...)
+	for _, t := range a.tags {
+		a.key = append(a.key, 0)
+		a.key = append(a.key, t.Key...)
+		a.key = append(a.key, 0)
+		a.key = append(a.key, t.Value...)
+	}
+	return a.key
+}
+
+func tagLess(a, b parse.Tag) bool {
+	if c := bytes.Compare(a.Key, b.Key); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(a.Value, b.Value) < 0
+}
+
+// newSeries returns the Series of l, with the given sorted tags.
+func newSeries(l *parse.Line, tags []parse.Tag) Series {
+	s := Series{Name: string(l.Name)}
+	if len(tags) > 0 {
+		s.Tags = make([]statsd.Tag, len(tags))
+		for i, t := range tags {
+			s.Tags[i] = statsd.Tag{string(t.Key), string(t.Value)}
+		}
+	}
+	return s
+}
+
+// flush returns the metrics aggregated since the previous flush, and resets
+// the aggregator.
+func (a *aggregator) flush(now time.Time, interval time.Duration) *Metrics {
+	m := &Metrics{
+		Time:     now,
+		Interval: interval,
+		Lines:    a.lines,
+		BadLines: a.badLines,
+	}
+	seconds := interval.Seconds()
+	perSecond := func(v float64) float64 {
+		if seconds <= 0 {
+			return 0
+		}
+		return v / seconds
+	}
+
+	for k, c := range a.counters {
+		m.Counters = append(m.Counters, Counter{Series: c.series, Value: c.value, PerSecond: perSecond(c.value)})
+		delete(a.counters, k)
+	}
+	for k, g := range a.gauges {
+		m.Gauges = append(m.Gauges, Gauge{Series: g.series, Value: g.value})
+		if a.deleteGauges {
+			delete(a.gauges, k)
+		}
+	}
+	for k, s := range a.sets {
+		members := make([]string, 0, len(s.members))
+		for v := range s.members {
+			members = append(members, v)
+		}
+		sort.Strings(members)
+		m.Sets = append(m.Sets, Set{Series: s.series, Members: members})
+		delete(a.sets, k)
+	}
+	for k, t := range a.timers {
+		timer := a.timerMetrics(t)
+		timer.PerSecond = perSecond(timer.Count)
+		m.Timers = append(m.Timers, timer)
+		delete(a.timers, k)
+	}
+	a.lines, a.badLines = 0, 0
+
+	sort.Slice(m.Counters, func(i, j int) bool { return m.Counters[i].Series.less(m.Counters[j].Series) })
+	sort.Slice(m.Gauges, func(i, j int) bool { return m.Gauges[i].Series.less(m.Gauges[j].Series) })
+	sort.Slice(m.Sets, func(i, j int) bool { return m.Sets[i].Series.less(m.Sets[j].Series) })
+	sort.Slice(m.Timers, func(i, j int) bool { return m.Timers[i].Series.less(m.Timers[j].Series) })
+	return m
+}
+
+// timerMetrics computes the statistics of a timer, as the Etsy statsd daemon
+// does.
+func (a *aggregator) timerMetrics(t *timerState) Timer {
+	values := t.values
+	sort.Float64s(values)
+	n := len(values)
+
+	timer := Timer{
+		Series:  t.series,
+		Count:   t.count,
+		Samples: n,
+		Min:     values[0],
+		Max:     values[n-1],
+	}
+
+	// cumulative sums, for the percentiles
+	cumulative := make([]float64, n)
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		cumulative[i] = sum
+	}
+	timer.Sum = sum
+	timer.Mean = sum / float64(n)
+
+	if mid := n / 2; n%2 == 1 {
+		timer.Median = values[mid]
+	} else {
+		timer.Median = (values[mid-1] + values[mid]) / 2
+	}
+
+	variance := 0.0
+	for _, v := range values {
+		d := v - timer.Mean
+		variance += d * d
+	}
+	timer.Stddev = math.Sqrt(variance / float64(n))
+
+	for _, pct := range a.percentiles {
+		count := int(math.Round(pct / 100 * float64(n)))
+		if count <= 0 {
+			continue
+		}
+		if count > n {
+			count = n
+		}
+		timer.Percentiles = append(timer.Percentiles, Percentile{
+			Percent: pct,
+			Count:   count,
+			Upper:   values[count-1],
+			Sum:     cumulative[count-1],
+			Mean:    cumulative[count-1] / float64(count),
+		})
+	}
+	return timer
+}
+
+// less orders series by name, then tags.
+func (s Series) less(o Series) bool {
+	if s.Name != o.Name {
+		return s.Name < o.Name
+	}
+	for i := 0; i < len(s.Tags) && i < len(o.Tags); i++ {
+		if s.Tags[i] != o.Tags[i] {
+			if s.Tags[i][0] != o.Tags[i][0] {
+				return s.Tags[i][0] < o.Tags[i][0]
+			}
+			return s.Tags[i][1] < o.Tags[i][1]
+		}
+	}
+	return len(s.Tags) < len(o.Tags)
+}
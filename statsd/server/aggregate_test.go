@@ -0,0 +1,138 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+	"github.com/cactus/go-statsd-client/v6/statsd/parse"
+)
+
+// aggregate parses and aggregates lines, returning the metrics of a 10s
+// interval.
+func aggregate(t *testing.T, a *aggregator, lines ...string) *Metrics {
+	t.Helper()
+	err := parse.ParsePacket([]byte(strings.Join(lines, "\n")), a.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.flush(time.Unix(100, 0), 10*time.Second)
+}
+
+func TestAggregateCounters(t *testing.T) {
+	a := newAggregator([]float64{90}, false)
+	m := aggregate(t, a,
+		"hits:1|c",
+		"hits:2|c|@0.5",
+		"hits:1|c|#b:2,a:1",
+		"hits:1|c|#a:1,b:2",
+	)
+
+	want := []Counter{
+		{Series{"hits", nil}, 5, 0.5},
+		{Series{"hits", []statsd.Tag{{"a", "1"}, {"b", "2"}}}, 2, 0.2},
+	}
+	if !reflect.DeepEqual(m.Counters, want) {
+		t.Errorf("got %+v, want %+v", m.Counters, want)
+	}
+	if m.Lines != 4 || m.Time != time.Unix(100, 0) || m.Interval != 10*time.Second {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+
+	// counters are reset at each flush
+	if m := a.flush(time.Unix(110, 0), 10*time.Second); len(m.Counters) != 0 || m.Lines != 0 {
+		t.Errorf("expected no counters, got %+v", m.Counters)
+	}
+}
+
+func TestAggregateGauges(t *testing.T) {
+	a := newAggregator(nil, false)
+	m := aggregate(t, a, "temp:10|g", "temp:+5|g", "temp:-3|g", "delta:-2|g")
+
+	want := []Gauge{
+		{Series{"delta", nil}, -2},
+		{Series{"temp", nil}, 12},
+	}
+	if !reflect.DeepEqual(m.Gauges, want) {
+		t.Errorf("got %+v, want %+v", m.Gauges, want)
+	}
+
+	// gauges keep their value
+	m = aggregate(t, a, "temp:+1|g")
+	want[1].Value = 13
+	if !reflect.DeepEqual(m.Gauges, want) {
+		t.Errorf("got %+v, want %+v", m.Gauges, want)
+	}
+
+	a = newAggregator(nil, true)
+	aggregate(t, a, "temp:10|g")
+	if m := a.flush(time.Unix(110, 0), 10*time.Second); len(m.Gauges) != 0 {
+		t.Errorf("expected gauges to be deleted, got %+v", m.Gauges)
+	}
+}
+
+func TestAggregateSets(t *testing.T) {
+	a := newAggregator(nil, false)
+	m := aggregate(t, a, "users:b|s", "users:a|s", "users:b|s")
+
+	want := []Set{{Series{"users", nil}, []string{"a", "b"}}}
+	if !reflect.DeepEqual(m.Sets, want) {
+		t.Errorf("got %+v, want %+v", m.Sets, want)
+	}
+}
+
+func TestAggregateTimers(t *testing.T) {
+	a := newAggregator([]float64{50, 90, 99.9}, false)
+	var lines []string
+	for _, v := range []string{"7", "3", "10", "1", "5", "2", "9", "4", "8"} {
+		lines = append(lines, "latency:"+v+"|ms")
+	}
+	lines = append(lines, "latency:6|h|@0.5")
+	m := aggregate(t, a, lines...)
+
+	if len(m.Timers) != 1 {
+		t.Fatalf("got %+v", m.Timers)
+	}
+	got := m.Timers[0]
+	want := Timer{
+		Series:    Series{"latency", nil},
+		Count:     11,
+		PerSecond: 1.1,
+		Samples:   10,
+		Sum:       55,
+		Min:       1,
+		Max:       10,
+		Mean:      5.5,
+		Median:    5.5,
+		Stddev:    math.Sqrt(8.25),
+		Percentiles: []Percentile{
+			{Percent: 50, Count: 5, Upper: 5, Sum: 15, Mean: 3},
+			{Percent: 90, Count: 9, Upper: 9, Sum: 45, Mean: 5},
+			{Percent: 99.9, Count: 10, Upper: 10, Sum: 55, Mean: 5.5},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	// odd number of values
+	m = aggregate(t, a, "t:1|ms", "t:5|d", "t:2|ms")
+	if got := m.Timers[0]; got.Median != 2 || got.Min != 1 || got.Max != 5 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestAggregateIgnoresEvents(t *testing.T) {
+	a := newAggregator(nil, false)
+	m := aggregate(t, a, "_e{1,1}:a|b", "_sc|check|0", "c:1|c")
+	if m.Lines != 3 || len(m.Counters) != 1 {
+		t.Errorf("got %+v", m)
+	}
+}
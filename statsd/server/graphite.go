@@ -0,0 +1,83 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// graphiteBackend writes metrics in the Graphite plaintext protocol.
+type graphiteBackend struct {
+	w io.Writer
+}
+
+// NewGraphiteBackend returns a Backend writing the metrics of each flush to w
+// in the Graphite plaintext protocol, with the names used by the Etsy statsd
+// daemon (eg. "{name}.count" and "{name}.rate" for counters, or
+// "{name}.upper_90" for timers). Tags are written in the Graphite tagged
+// series format, "{name};{key}={value}".
+//
+// w may be a connection to Graphite, or os.Stdout for local development.
+func NewGraphiteBackend(w io.Writer) Backend {
+	return &graphiteBackend{w: w}
+}
+
+func (g *graphiteBackend) Flush(m *Metrics) error {
+	ts := strconv.FormatInt(m.Time.Unix(), 10)
+	var b bytes.Buffer
+
+	line := func(s Series, suffix string, v float64) {
+		b.WriteString(s.Name)
+		b.WriteString(suffix)
+		for _, t := range s.Tags {
+			b.WriteByte(';')
+			b.WriteString(t[0])
+			b.WriteByte('=')
+			b.WriteString(t[1])
+		}
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(ts)
+		b.WriteByte('\n')
+	}
+
+	for _, c := range m.Counters {
+		line(c.Series, ".count", c.Value)
+		line(c.Series, ".rate", c.PerSecond)
+	}
+	for _, g := range m.Gauges {
+		line(g.Series, "", g.Value)
+	}
+	for _, s := range m.Sets {
+		line(s.Series, ".count", float64(len(s.Members)))
+	}
+	for _, t := range m.Timers {
+		line(t.Series, ".count", t.Count)
+		line(t.Series, ".count_ps", t.PerSecond)
+		line(t.Series, ".sum", t.Sum)
+		line(t.Series, ".lower", t.Min)
+		line(t.Series, ".upper", t.Max)
+		line(t.Series, ".mean", t.Mean)
+		line(t.Series, ".median", t.Median)
+		line(t.Series, ".std", t.Stddev)
+		for _, p := range t.Percentiles {
+			pct := strings.ReplaceAll(strconv.FormatFloat(p.Percent, 'f', -1, 64), ".", "_")
+			line(t.Series, ".count_"+pct, float64(p.Count))
+			line(t.Series, ".upper_"+pct, p.Upper)
+			line(t.Series, ".sum_"+pct, p.Sum)
+			line(t.Series, ".mean_"+pct, p.Mean)
+		}
+	}
+
+	if b.Len() == 0 {
+		return nil
+	}
+	_, err := g.w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+func TestGraphiteBackend(t *testing.T) {
+	tags := []statsd.Tag{{"code", "200"}}
+	m := &Metrics{
+		Time:     time.Unix(1656581400, 0),
+		Counters: []Counter{{Series{"hits", tags}, 20, 2}},
+		Gauges:   []Gauge{{Series{"conns", nil}, 7.5}},
+		Sets:     []Set{{Series{"users", nil}, []string{"a", "b"}}},
+		Timers: []Timer{{
+			Series: Series{"latency", nil},
+			Count:  2, PerSecond: 0.2,
+			Sum: 3, Min: 1, Max: 2, Mean: 1.5, Median: 1.5, Stddev: 0.5,
+			Percentiles: []Percentile{{Percent: 99.5, Count: 2, Upper: 2, Sum: 3, Mean: 1.5}},
+		}},
+	}
+
+	var b bytes.Buffer
+	if err := NewGraphiteBackend(&b).Flush(m); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `hits.count;code=200 20 1656581400
+hits.rate;code=200 2 1656581400
+conns 7.5 1656581400
+users.count 2 1656581400
+latency.count 2 1656581400
+latency.count_ps 0.2 1656581400
+latency.sum 3 1656581400
+latency.lower 1 1656581400
+latency.upper 2 1656581400
+latency.mean 1.5 1656581400
+latency.median 1.5 1656581400
+latency.std 0.5 1656581400
+latency.count_99_5 2 1656581400
+latency.upper_99_5 2 1656581400
+latency.sum_99_5 3 1656581400
+latency.mean_99_5 1.5 1656581400
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// nothing is written for an empty flush
+	b.Reset()
+	if err := NewGraphiteBackend(&b).Flush(&Metrics{}); err != nil || b.Len() != 0 {
+		t.Errorf("got %q, %v", b.String(), err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+// Backend receives the aggregated metrics of a Server at each flush.
+type Backend interface {
+	// Flush is called with the metrics of each flush interval. It must not
+	// retain m after returning, or modify it.
+	Flush(m *Metrics) error
+}
+
+// BackendFunc adapts a function to a Backend.
+type BackendFunc func(m *Metrics) error
+
+// Flush calls f(m).
+func (f BackendFunc) Flush(m *Metrics) error {
+	return f(m)
+}
+
+// Metrics are the metrics aggregated during a flush interval. Each list is
+// sorted by name, then tags.
+type Metrics struct {
+	// Time is the time of the flush.
+	Time time.Time
+	// Interval is the time since the previous flush (or the start of the
+	// Server).
+	Interval time.Duration
+
+	Counters []Counter
+	Gauges   []Gauge
+	Sets     []Set
+	Timers   []Timer
+
+	// Lines is the number of valid lines received, and BadLines the number
+	// of invalid lines.
+	Lines    int
+	BadLines int
+}
+
+// Series identifies a metric by name and tags. Tags are sorted by key, then
+// value, so that stats differing in tag order are aggregated together.
+type Series struct {
+	Name string
+	Tags []statsd.Tag
+}
+
+// Counter is an aggregated counter.
+type Counter struct {
+	Series
+	// Value is the sum of the counts received, corrected for sample rates.
+	Value float64
+	// PerSecond is Value divided by the flush interval.
+	PerSecond float64
+}
+
+// Gauge is a gauge. Gauges keep their value across flushes, unless
+// Config.DeleteGauges is set.
+type Gauge struct {
+	Series
+	Value float64
+}
+
+// Set is an aggregated set.
+type Set struct {
+	Series
+	// Members are the distinct members received, sorted.
+	Members []string
+}
+
+// Timer is an aggregated timer (or histogram, or distribution).
+type Timer struct {
+	Series
+	// Count is the number of values received, corrected for sample rates.
+	Count float64
+	// PerSecond is Count divided by the flush interval.
+	PerSecond float64
+	// Samples is the number of values received, not corrected for sample
+	// rates.
+	Samples int
+
+	// Statistics of the values received, which are not corrected for
+	// sample rates.
+	Sum    float64
+	Min    float64
+	Max    float64
+	Mean   float64
+	Median float64
+	Stddev float64
+
+	// Percentiles holds the statistics of each of Config.Percentiles.
+	Percentiles []Percentile
+}
+
+// Percentile holds the statistics of the lowest Percent percent of the values
+// of a Timer.
+type Percentile struct {
+	Percent float64
+	// Count is the number of values below the percentile.
+	Count int
+	// Upper is the largest value below the percentile.
+	Upper float64
+	Sum   float64
+	Mean  float64
+}
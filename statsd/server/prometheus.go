@@ -0,0 +1,334 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+const (
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// PrometheusBackend is a Backend keeping the metrics flushed to it, which
+// serves them over HTTP in the Prometheus text exposition format, or in the
+// OpenMetrics format if the scraper accepts it. It allows exposing the stats
+// sent by a statsd.Client on "/metrics", without a statsd_exporter:
+//
+//	prom := server.NewPrometheusBackend()
+//	srv, err := server.New(&server.Config{
+//		FlushInterval: 5 * time.Second,
+//		Backends:      []server.Backend{prom},
+//	})
+//	// ...
+//	statter, err := statsd.NewClientWithSender(srv, "app", 0)
+//	http.Handle("/metrics", prom)
+//
+// Stat names are converted to valid metric names by replacing invalid
+// characters (eg. '.') with '_', and tags become labels, with their keys
+// converted likewise (later tags converted to an already used label name are
+// dropped). Stats are exposed as of the last flush:
+//
+//   - counters as counters, with the totals of all flushes
+//   - gauges as gauges
+//   - sets as gauges, with the number of distinct members of the last flush
+//   - timers as summaries, with a quantile for each of Config.Percentiles
+//     over the last flush (NaN if it had no values), and the totals of all
+//     flushes. Values are exposed in the unit sent (milliseconds for timings).
+//
+// Series are kept once seen. A name used with several types is exposed with
+// the type it was first flushed with, and dropped for the others.
+type PrometheusBackend struct {
+	mx       sync.Mutex
+	families map[string]*promFamily
+}
+
+// promKind is the metric type of a promFamily.
+type promKind uint8
+
+const (
+	promCounter promKind = iota
+	promGauge
+	promSummary
+)
+
+func (k promKind) String() string {
+	switch k {
+	case promCounter:
+		return "counter"
+	case promGauge:
+		return "gauge"
+	}
+	return "summary"
+}
+
+// promFamily is a metric family, ie. the series of a metric name.
+type promFamily struct {
+	name   string
+	kind   promKind
+	series map[string]*promSeries
+}
+
+// promSeries is a series of a family.
+type promSeries struct {
+	// rendered labels, eg. `code="200",method="GET"`
+	labels string
+	// whether the series is a set, exposed as a gauge
+	set bool
+	// value of a counter or gauge
+	value float64
+	// totals and quantiles of a summary
+	sum       float64
+	count     float64
+	quantiles []promQuantile
+}
+
+type promQuantile struct {
+	q string
+	v float64
+}
+
+// NewPrometheusBackend returns a new PrometheusBackend.
+func NewPrometheusBackend() *PrometheusBackend {
+	return &PrometheusBackend{families: make(map[string]*promFamily)}
+}
+
+// Flush updates the metrics served with those of m.
+func (p *PrometheusBackend) Flush(m *Metrics) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	// sets and quantiles only describe the last flush
+	for _, f := range p.families {
+		for _, s := range f.series {
+			if s.set {
+				s.value = 0
+			}
+			for i := range s.quantiles {
+				s.quantiles[i].v = math.NaN()
+			}
+		}
+	}
+
+	for _, c := range m.Counters {
+		if s := p.series(c.Series, promCounter); s != nil {
+			s.value += c.Value
+		}
+	}
+	for _, g := range m.Gauges {
+		if s := p.series(g.Series, promGauge); s != nil && !s.set {
+			s.value = g.Value
+		}
+	}
+	for _, set := range m.Sets {
+		if s := p.series(set.Series, promGauge); s != nil {
+			s.set = true
+			s.value = float64(len(set.Members))
+		}
+	}
+	for _, t := range m.Timers {
+		s := p.series(t.Series, promSummary)
+		if s == nil {
+			continue
+		}
+		s.count += t.Count
+		if t.Samples > 0 {
+			// correct the sum for sample rates, as the count is
+			s.sum += t.Sum * t.Count / float64(t.Samples)
+		}
+		s.quantiles = s.quantiles[:0]
+		for _, pct := range t.Percentiles {
+			s.quantiles = append(s.quantiles, promQuantile{
+				// limit the precision, to hide the rounding of the division
+				q: strconv.FormatFloat(pct.Percent/100, 'g', 12, 64),
+				v: pct.Upper,
+			})
+		}
+	}
+	return nil
+}
+
+// series returns the series of s in a family of kind, creating it if needed,
+// or nil if the name is used by a family of another kind.
+func (p *PrometheusBackend) series(s Series, kind promKind) *promSeries {
+	name := promName(s.Name)
+	if kind == promCounter {
+		// the family of "{name}_total" samples
+		name = strings.TrimSuffix(name, "_total")
+	}
+
+	f, ok := p.families[name]
+	if !ok {
+		f = &promFamily{name: name, kind: kind, series: make(map[string]*promSeries)}
+		p.families[name] = f
+	}
+	if f.kind != kind {
+		return nil
+	}
+
+	labels := promLabels(s.Tags, kind == promSummary)
+	ps, ok := f.series[labels]
+	if !ok {
+		ps = &promSeries{labels: labels}
+		f.series[labels] = ps
+	}
+	return ps
+}
+
+// ServeHTTP writes the metrics, in the OpenMetrics format if the request
+// accepts it, otherwise in the Prometheus text format.
+func (p *PrometheusBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	var b bytes.Buffer
+	p.write(&b, openMetrics)
+
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+	w.Write(b.Bytes())
+}
+
+// write renders the metrics to b, sorted by name and labels.
+func (p *PrometheusBackend) write(b *bytes.Buffer, openMetrics bool) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := p.families[name]
+		labels := make([]string, 0, len(f.series))
+		for l := range f.series {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+
+		sample := f.name
+		if f.kind == promCounter {
+			sample += "_total"
+			if !openMetrics {
+				// the family is named after its samples
+				name = sample
+			}
+		}
+		b.WriteString("# TYPE " + name + " " + f.kind.String() + "\n")
+
+		for _, l := range labels {
+			s := f.series[l]
+			if f.kind != promSummary {
+				writeSample(b, sample, s.labels, "", s.value)
+				continue
+			}
+			for _, q := range s.quantiles {
+				writeSample(b, sample, s.labels, `quantile="`+q.q+`"`, q.v)
+			}
+			writeSample(b, sample+"_sum", s.labels, "", s.sum)
+			writeSample(b, sample+"_count", s.labels, "", s.count)
+		}
+	}
+
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+}
+
+// writeSample writes a sample line, with labels and an extra label (each
+// rendered, and possibly empty).
+func writeSample(b *bytes.Buffer, name, labels, extra string, v float64) {
+	b.WriteString(name)
+	if labels != "" || extra != "" {
+		b.WriteByte('{')
+		b.WriteString(labels)
+		if labels != "" && extra != "" {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra)
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	b.WriteByte('\n')
+}
+
+// promName converts a stat name to a valid metric name, replacing invalid
+// characters with '_', and prefixing a leading digit with '_'.
+func promName(name string) string {
+	return promSanitize(name, true)
+}
+
+// promLabels renders tags as labels, with their keys converted to valid label
+// names. Tags converted to a label name already used (or reserved, like
+// "quantile" for summaries) are dropped.
+func promLabels(tags []statsd.Tag, summary bool) string {
+	var b strings.Builder
+	used := make(map[string]bool, len(tags))
+	if summary {
+		used["quantile"] = true
+	}
+	for _, t := range tags {
+		key := promSanitize(t[0], false)
+		if used[key] || strings.HasPrefix(key, "__") {
+			continue
+		}
+		used[key] = true
+
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(key)
+		b.WriteString(`="`)
+		for i := 0; i < len(t[1]); i++ {
+			switch c := t[1][i]; c {
+			case '\\', '"':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case '\n':
+				b.WriteString(`\n`)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// promSanitize replaces the characters of s invalid in a metric name (or, if
+// not metric, a label name) with '_'. Colons are only valid in metric names.
+func promSanitize(s string, metric bool) string {
+	var b strings.Builder
+	b.Grow(len(s) + 1)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':' && metric:
+			b.WriteByte(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+	"github.com/cactus/go-statsd-client/v6/statsd/statsdtest"
+)
+
+// scrape returns the content type and body served by h.
+func scrape(t *testing.T, h http.Handler, accept string) (string, string) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	body, err := ioutil.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Header.Get("Content-Type"), string(body)
+}
+
+func TestPrometheusBackend(t *testing.T) {
+	prom := NewPrometheusBackend()
+	tags := []statsd.Tag{{"code", "200"}}
+	timer := Timer{
+		Series:      Series{"app.latency", tags},
+		Count:       4,
+		Samples:     2,
+		Sum:         30,
+		Percentiles: []Percentile{{Percent: 50, Upper: 10}, {Percent: 99.9, Upper: 20}},
+	}
+
+	prom.Flush(&Metrics{
+		Counters: []Counter{{Series: Series{"app.hits", tags}, Value: 3}},
+		Gauges:   []Gauge{{Series: Series{"app.conns", nil}, Value: 7}},
+		Sets:     []Set{{Series: Series{"app.users", nil}, Members: []string{"a", "b"}}},
+		Timers:   []Timer{timer},
+	})
+	prom.Flush(&Metrics{
+		Counters: []Counter{{Series: Series{"app.hits", tags}, Value: 2}},
+	})
+
+	contentType, body := scrape(t, prom, "")
+	if contentType != prometheusContentType {
+		t.Errorf("got content type %q", contentType)
+	}
+	want := `# TYPE app_conns gauge
+app_conns 7
+# TYPE app_hits_total counter
+app_hits_total{code="200"} 5
+# TYPE app_latency summary
+app_latency{code="200",quantile="0.5"} NaN
+app_latency{code="200",quantile="0.999"} NaN
+app_latency_sum{code="200"} 60
+app_latency_count{code="200"} 4
+# TYPE app_users gauge
+app_users 0
+`
+	if body != want {
+		t.Errorf("got:\n%s\nwant:\n%s", body, want)
+	}
+
+	prom.Flush(&Metrics{Timers: []Timer{timer}})
+	contentType, body = scrape(t, prom, "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	if contentType != openMetricsContentType {
+		t.Errorf("got content type %q", contentType)
+	}
+	want = `# TYPE app_conns gauge
+app_conns 7
+# TYPE app_hits counter
+app_hits_total{code="200"} 5
+# TYPE app_latency summary
+app_latency{code="200",quantile="0.5"} 10
+app_latency{code="200",quantile="0.999"} 20
+app_latency_sum{code="200"} 120
+app_latency_count{code="200"} 8
+# TYPE app_users gauge
+app_users 0
+# EOF
+`
+	if body != want {
+		t.Errorf("got:\n%s\nwant:\n%s", body, want)
+	}
+}
+
+func TestPrometheusNames(t *testing.T) {
+	prom := NewPrometheusBackend()
+	prom.Flush(&Metrics{
+		Counters: []Counter{
+			{Series: Series{"1st.requests_total", []statsd.Tag{{"http.code", "2\"0\\0\n"}, {"http-code", "dup"}, {"__name__", "x"}}}, Value: 1},
+			{Series: Series{"both", nil}, Value: 1},
+		},
+		Gauges: []Gauge{{Series: Series{"both", nil}, Value: 2}},
+		Timers: []Timer{{Series: Series{"rpc:time", []statsd.Tag{{"quantile", "x"}, {"9", "y"}}}, Count: 1, Samples: 1, Sum: 1}},
+	})
+
+	_, body := scrape(t, prom, "")
+	want := `# TYPE _1st_requests_total counter
+_1st_requests_total{http_code="2\"0\\0\n"} 1
+# TYPE both_total counter
+both_total 1
+# TYPE rpc:time summary
+rpc:time_sum{_9="y"} 1
+rpc:time_count{_9="y"} 1
+`
+	if body != want {
+		t.Errorf("got:\n%s\nwant:\n%s", body, want)
+	}
+}
+
+func TestPrometheusServer(t *testing.T) {
+	prom := NewPrometheusBackend()
+	srv, err := New(&Config{
+		Backends: []Backend{prom},
+		Clock:    statsdtest.NewFakeClock(time.Now()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	statter, err := statsd.NewClientWithSender(srv, "app", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statter.Inc("requests", 1, 1.0, statsd.Tag{"route", "/"})
+	statter.Inc("requests", 1, 1.0, statsd.Tag{"route", "/"})
+	statter.Gauge("load", 5, 1.0)
+	if err := srv.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, body := scrape(t, prom, "")
+	want := `# TYPE app_load gauge
+app_load 5
+# TYPE app_requests_total counter
+app_requests_total{route="/"} 2
+`
+	if body != want {
+		t.Errorf("got:\n%s\nwant:\n%s", body, want)
+	}
+}
@@ -0,0 +1,397 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package server implements an embeddable statsd server, which receives stats
+// over UDP, TCP or a unix datagram socket (or in-process, as a statsd.Sender),
+// aggregates them with the semantics of the Etsy statsd daemon, and flushes
+// the aggregated metrics to Backends at intervals.
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+	"github.com/cactus/go-statsd-client/v6/statsd/parse"
+)
+
+// maxLineSize is the maximum length of a line received over TCP.
+const maxLineSize = 64 * 1024
+
+// Config holds the settings of a Server.
+type Config struct {
+	// UDPAddr is the address to listen on for UDP, eg. "127.0.0.1:8125".
+	// If empty, the Server does not listen on UDP.
+	UDPAddr string
+
+	// TCPAddr is the address to listen on for TCP, on which stats are
+	// newline delimited. If empty, the Server does not listen on TCP.
+	TCPAddr string
+
+	// UnixPath is the path of a unix datagram socket to listen on. If
+	// empty, the Server does not listen on one.
+	UnixPath string
+
+	// TagFormat is the tag format of the stats received, see parse.Parser.
+	TagFormat statsd.TagFormat
+
+	// FlushInterval is the interval at which metrics are flushed to the
+	// Backends. If 0, defaults to 10 seconds.
+	FlushInterval time.Duration
+
+	// Percentiles are the percentiles computed for timers, each in (0, 100].
+	// If nil, defaults to 90.
+	Percentiles []float64
+
+	// DeleteGauges determines whether gauges are deleted at each flush,
+	// rather than being flushed with their last value until updated.
+	DeleteGauges bool
+
+	// Backends receive the metrics at each flush, in order.
+	Backends []Backend
+
+	// Clock, if set, is used to schedule flushes instead of the system
+	// clock. See statsdtest.FakeClock.
+	Clock statsd.Clock
+
+	// Logger, if set, logs invalid lines, and errors of Backends and
+	// listeners.
+	Logger *log.Logger
+}
+
+// Server is an embeddable statsd server. It should be constructed with New.
+//
+// A Server is also a statsd.Sender, so that a statsd.Client may send to it
+// in-process. Closing such a Client closes the Server.
+type Server struct {
+	parser   parse.Parser
+	backends []Backend
+	clock    statsd.Clock
+	logger   *log.Logger
+
+	udp  net.PacketConn
+	tcp  net.Listener
+	unix net.PacketConn
+
+	// guards agg and last
+	mx  sync.Mutex
+	agg *aggregator
+	// time of the previous flush
+	last time.Time
+
+	// serializes flushes, so that Backends see them in order
+	flushMx sync.Mutex
+
+	// guards conns and closed
+	connMx sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a new Server, listening and flushing as configured by config.
+func New(config *Config) (*Server, error) {
+	// guard against nil config
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	if config.TagFormat&statsd.InfluxLine != 0 {
+		return nil, fmt.Errorf("InfluxLine is not supported")
+	}
+
+	percentiles := config.Percentiles
+	if percentiles == nil {
+		percentiles = []float64{90}
+	}
+	for _, p := range percentiles {
+		if !(p > 0 && p <= 100) {
+			return nil, fmt.Errorf("invalid percentile %v", p)
+		}
+	}
+
+	interval := config.FlushInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	clock := config.Clock
+	if clock == nil {
+		clock = statsd.SystemClock
+	}
+
+	s := &Server{
+		parser:   parse.Parser{TagFormat: config.TagFormat},
+		backends: append([]Backend(nil), config.Backends...),
+		clock:    clock,
+		logger:   config.Logger,
+		agg:      newAggregator(append([]float64(nil), percentiles...), config.DeleteGauges),
+		last:     clock.Now(),
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if err := s.listen(config); err != nil {
+		s.closeListeners()
+		return nil, err
+	}
+
+	ticker := clock.NewTicker(interval)
+	s.wg.Add(1)
+	go s.run(ticker)
+	return s, nil
+}
+
+// listen starts the configured listeners.
+func (s *Server) listen(config *Config) error {
+	var err error
+	if config.UDPAddr != "" {
+		if s.udp, err = net.ListenPacket("udp", config.UDPAddr); err != nil {
+			return err
+		}
+		s.servePackets(s.udp)
+	}
+
+	if config.TCPAddr != "" {
+		if s.tcp, err = net.Listen("tcp", config.TCPAddr); err != nil {
+			return err
+		}
+		s.wg.Add(1)
+		go s.acceptTCP()
+	}
+
+	if config.UnixPath != "" {
+		if s.unix, err = net.ListenPacket("unixgram", config.UnixPath); err != nil {
+			return err
+		}
+		s.servePackets(s.unix)
+	}
+	return nil
+}
+
+// UDPAddr returns the UDP address of the Server, or "" if it does not listen
+// on UDP.
+func (s *Server) UDPAddr() string {
+	if s.udp == nil {
+		return ""
+	}
+	return s.udp.LocalAddr().String()
+}
+
+// TCPAddr returns the TCP address of the Server, or "" if it does not listen
+// on TCP.
+func (s *Server) TCPAddr() string {
+	if s.tcp == nil {
+		return ""
+	}
+	return s.tcp.Addr().String()
+}
+
+// UnixAddr returns the path of the unix datagram socket of the Server, or ""
+// if it does not listen on one.
+func (s *Server) UnixAddr() string {
+	if s.unix == nil {
+		return ""
+	}
+	return s.unix.LocalAddr().String()
+}
+
+// Send aggregates the stats in data, making the Server a statsd.Sender. Any
+// invalid lines are returned as an error (see parse.Parser.ParsePacket),
+// after the valid ones are aggregated.
+func (s *Server) Send(data []byte) (int, error) {
+	s.connMx.Lock()
+	closed := s.closed
+	s.connMx.Unlock()
+	if closed {
+		return 0, fmt.Errorf("server is closed")
+	}
+
+	return len(data), s.handle(data)
+}
+
+// Flush flushes the metrics aggregated since the previous flush to the
+// Backends right away, returning their errors joined.
+func (s *Server) Flush() error {
+	s.flushMx.Lock()
+	defer s.flushMx.Unlock()
+
+	now := s.clock.Now()
+	s.mx.Lock()
+	m := s.agg.flush(now, now.Sub(s.last))
+	s.last = now
+	s.mx.Unlock()
+
+	var errs []error
+	for _, b := range s.backends {
+		if err := b.Flush(m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return statsd.JoinErrors(errs)
+}
+
+// Close stops the Server, and flushes any remaining metrics to the Backends,
+// returning their errors. Close may be called more than once.
+func (s *Server) Close() error {
+	s.connMx.Lock()
+	if s.closed {
+		s.connMx.Unlock()
+		return nil
+	}
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.connMx.Unlock()
+
+	close(s.done)
+	s.closeListeners()
+	s.wg.Wait()
+	return s.Flush()
+}
+
+// closeListeners closes the listeners started, removing the unix socket.
+func (s *Server) closeListeners() {
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+	if s.unix != nil {
+		s.unix.Close()
+		os.Remove(s.unix.LocalAddr().String())
+	}
+}
+
+// run flushes on each tick, until the Server is closed.
+func (s *Server) run(ticker statsd.Ticker) {
+	defer s.wg.Done()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := s.Flush(); err != nil {
+				s.logf("flush: %s", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// handle aggregates the stats in data.
+func (s *Server) handle(data []byte) error {
+	s.mx.Lock()
+	err := s.parser.ParsePacket(data, s.agg.add)
+	if err != nil {
+		s.agg.badLines += countErrors(err)
+	}
+	s.mx.Unlock()
+
+	if err != nil {
+		s.logf("%s", err)
+	}
+	return err
+}
+
+// countErrors returns the number of errors joined in err.
+func countErrors(err error) int {
+	if m, ok := err.(*statsd.MultiError); ok {
+		return len(m.Errors())
+	}
+	return 1
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf("statsd server: "+format, args...)
+	}
+}
+
+// servePackets aggregates the stats received on conn, until it is closed.
+func (s *Server) servePackets(conn net.PacketConn) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !s.isClosed() {
+					s.logf("read: %s", err)
+				}
+				return
+			}
+			if n > 0 {
+				s.handle(buf[:n])
+			}
+		}
+	}()
+}
+
+// acceptTCP serves TCP connections, until the listener is closed.
+func (s *Server) acceptTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if !s.isClosed() {
+				s.logf("accept: %s", err)
+			}
+			return
+		}
+
+		s.connMx.Lock()
+		if s.closed {
+			s.connMx.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.connMx.Unlock()
+
+		s.wg.Add(1)
+		go s.serveTCP(conn)
+	}
+}
+
+// serveTCP aggregates the newline delimited stats received on conn.
+func (s *Server) serveTCP(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.connMx.Lock()
+		delete(s.conns, conn)
+		s.connMx.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 {
+			s.handle(line)
+		}
+	}
+	if err := scanner.Err(); err != nil && !s.isClosed() {
+		s.logf("tcp: %s", err)
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.connMx.Lock()
+	defer s.connMx.Unlock()
+	return s.closed
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2012-2016 Eli Janssen
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+	"github.com/cactus/go-statsd-client/v6/statsd/parse"
+	"github.com/cactus/go-statsd-client/v6/statsd/statsdtest"
+)
+
+// recordBackend records the metrics flushed.
+type recordBackend struct {
+	mx      sync.Mutex
+	flushes []*Metrics
+	// closed (and replaced) at each flush
+	flushed chan struct{}
+}
+
+func newRecordBackend() *recordBackend {
+	return &recordBackend{flushed: make(chan struct{})}
+}
+
+func (r *recordBackend) Flush(m *Metrics) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.flushes = append(r.flushes, m)
+	close(r.flushed)
+	r.flushed = make(chan struct{})
+	return nil
+}
+
+func (r *recordBackend) take() []*Metrics {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	f := r.flushes
+	r.flushes = nil
+	return f
+}
+
+// counter returns the total of the counter name over the flushes.
+func counter(flushes []*Metrics, name string) float64 {
+	var sum float64
+	for _, m := range flushes {
+		for _, c := range m.Counters {
+			if c.Name == name {
+				sum += c.Value
+			}
+		}
+	}
+	return sum
+}
+
+func TestServerInProcess(t *testing.T) {
+	clock := statsdtest.NewFakeClock(time.Unix(1000, 0))
+	rb := newRecordBackend()
+	srv, err := New(&Config{
+		FlushInterval: time.Second,
+		Backends:      []Backend{rb},
+		Clock:         clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	statter, err := statsd.NewClientWithSender(srv, "app", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statter.Inc("hits", 3, 1.0, statsd.Tag{"code", "200"})
+	statter.Gauge("conns", 7, 1.0)
+	statter.Timing("latency", 12, 1.0)
+
+	flushed := rb.flushed
+	clock.Advance(time.Second)
+	<-flushed
+
+	flushes := rb.take()
+	if len(flushes) != 1 {
+		t.Fatalf("expected 1 flush, got %d", len(flushes))
+	}
+	m := flushes[0]
+	if m.Interval != time.Second || !m.Time.Equal(time.Unix(1001, 0)) || m.Lines != 3 {
+		t.Errorf("unexpected flush: %+v", m)
+	}
+	want := []Counter{{Series{"app.hits", []statsd.Tag{{"code", "200"}}}, 3, 3}}
+	if !reflect.DeepEqual(m.Counters, want) {
+		t.Errorf("got counters %+v, want %+v", m.Counters, want)
+	}
+	if len(m.Gauges) != 1 || m.Gauges[0].Value != 7 || len(m.Timers) != 1 || m.Timers[0].Max != 12 {
+		t.Errorf("got gauges %+v, timers %+v", m.Gauges, m.Timers)
+	}
+
+	// invalid lines are returned, and counted
+	if _, err := srv.Send([]byte("app.bad:x|c\napp.hits:1|c")); !errors.Is(err, parse.ErrValue) {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+	if err := srv.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	m = rb.take()[0]
+	if m.BadLines != 1 || m.Lines != 1 || counter([]*Metrics{m}, "app.hits") != 1 {
+		t.Errorf("unexpected flush: %+v", m)
+	}
+
+	// closing the client closes the server, flushing
+	statter.Inc("hits", 1, 1.0)
+	if err := statter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := counter(rb.take(), "app.hits"); got != 1 {
+		t.Errorf("expected a final flush, got %v", got)
+	}
+	if _, err := srv.Send([]byte("app.hits:1|c")); err == nil {
+		t.Error("expected an error sending to a closed server")
+	}
+	if n := clock.Tickers(); n != 0 {
+		t.Errorf("expected the flush ticker to be stopped, got %d", n)
+	}
+}
+
+func TestServerListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rb := newRecordBackend()
+	var logs bytes.Buffer
+	srv, err := New(&Config{
+		UDPAddr:   "127.0.0.1:0",
+		TCPAddr:   "127.0.0.1:0",
+		UnixPath:  filepath.Join(dir, "statsd.sock"),
+		TagFormat: statsd.InfixComma,
+		Backends:  []Backend{rb},
+		Clock:     statsdtest.NewFakeClock(time.Now()),
+		Logger:    log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	udp, err := statsd.NewClientWithConfig(&statsd.ClientConfig{
+		Address:   srv.UDPAddr(),
+		TagFormat: statsd.InfixComma,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	udp.Inc("udp", 1, 1.0, statsd.Tag{"k", "v"})
+
+	tcp, err := net.Dial("tcp", srv.TCPAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	tcp.Write([]byte("tcp:1|c\ntcp:2|c\nbad\n"))
+
+	unix, err := net.Dial("unixgram", srv.UnixAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close()
+	unix.Write([]byte("unix:1|c"))
+
+	var flushes []*Metrics
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := srv.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		flushes = append(flushes, rb.take()...)
+		if counter(flushes, "udp") == 1 && counter(flushes, "tcp") == 3 && counter(flushes, "unix") == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if counter(flushes, "udp") != 1 || counter(flushes, "tcp") != 3 || counter(flushes, "unix") != 1 {
+		t.Fatalf("stats not received: %+v", flushes)
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte(`statsd server: line 1: syntax error: "bad"`)) {
+		t.Errorf("expected the bad line to be logged, got %q", logs.String())
+	}
+}
+
+func TestServerBackendErrors(t *testing.T) {
+	errBackend := BackendFunc(func(*Metrics) error { return errors.New("backend down") })
+	rb := newRecordBackend()
+	srv, err := New(&Config{
+		Backends: []Backend{errBackend, rb},
+		Clock:    statsdtest.NewFakeClock(time.Now()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Send([]byte("a:1|c"))
+	if err := srv.Flush(); err == nil || err.Error() != "backend down" {
+		t.Errorf("expected the backend error, got %v", err)
+	}
+	if got := counter(rb.take(), "a"); got != 1 {
+		t.Errorf("expected later backends to be flushed, got %v", got)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, config := range []*Config{
+		nil,
+		{TagFormat: statsd.InfluxLine},
+		{Percentiles: []float64{0}},
+		{Percentiles: []float64{101}},
+		{UDPAddr: "256.0.0.1:0"},
+	} {
+		if srv, err := New(config); err == nil {
+			srv.Close()
+			t.Errorf("%+v: expected an error", config)
+		}
+	}
+}
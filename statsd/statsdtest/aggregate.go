@@ -0,0 +1,80 @@
+package statsdtest
+
+import "time"
+
+// The aggregation helpers below mimic how a statsd server combines the stats
+// sent for a name, regardless of tags (use CollectTagged first to aggregate a
+// single tagged series). Stats with an unparsable value are ignored.
+
+// ofType returns the stats with the bare name name and type t.
+func (s Stats) ofType(name string, t StatType) Stats {
+	return s.Collect(func(e Stat) bool {
+		return e.Name == name && e.Type() == t
+	})
+}
+
+// SumCounter returns the total of the counter name, correcting each value
+// for its sample rate, as a statsd server would.
+func (s Stats) SumCounter(name string) float64 {
+	var sum float64
+	for _, e := range s.ofType(name, TypeCounter) {
+		v, err := e.Float64()
+		if err != nil {
+			continue
+		}
+		rate, err := e.SampleRate()
+		if err != nil || rate <= 0 {
+			continue
+		}
+		sum += v / rate
+	}
+	return sum
+}
+
+// LastGauge returns the final value of the gauge name, and whether any
+// values were sent for it. Values with a leading '+' or '-' are applied as
+// deltas to the previous value, as a statsd server would.
+func (s Stats) LastGauge(name string) (float64, bool) {
+	var gauge float64
+	var found bool
+	for _, e := range s.ofType(name, TypeGauge) {
+		v, err := e.Float64()
+		if err != nil {
+			continue
+		}
+		found = true
+		if e.Value[0] == '+' || e.Value[0] == '-' {
+			gauge += v
+		} else {
+			gauge = v
+		}
+	}
+	return gauge, found
+}
+
+// SetMembers returns the distinct members sent for the set name, in the
+// order they were first sent.
+func (s Stats) SetMembers(name string) []string {
+	var members []string
+	seen := make(map[string]bool)
+	for _, e := range s.ofType(name, TypeSet) {
+		if !seen[e.Value] {
+			seen[e.Value] = true
+			members = append(members, e.Value)
+		}
+	}
+	return members
+}
+
+// Timings returns the values sent for the timing name, in order.
+func (s Stats) Timings(name string) []time.Duration {
+	var timings []time.Duration
+	for _, e := range s.ofType(name, TypeTiming) {
+		d, err := e.Duration()
+		if err != nil {
+			continue
+		}
+		timings = append(timings, d)
+	}
+	return timings
+}
@@ -0,0 +1,56 @@
+package statsdtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+func TestStatsAggregation(t *testing.T) {
+	rs := NewRecordingSender()
+	statter, err := statsd.NewClientWithSender(rs, "", statsd.InfixComma)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statter.(*statsd.Client).SetSamplerFunc(func(float32) bool { return true })
+
+	statter.Inc("count", 4, 1.0)
+	statter.Inc("count", 3, 0.5, statsd.Tag{"a", "b"})
+	statter.Dec("count", 2, 1.0)
+	statter.Inc("other", 100, 1.0)
+
+	statter.Gauge("gauge", 10, 1.0)
+	statter.GaugeDelta("gauge", 5, 1.0)
+	statter.GaugeDelta("gauge", -3, 1.0)
+
+	statter.Set("set", "one", 1.0)
+	statter.Set("set", "two", 1.0)
+	statter.Set("set", "one", 1.0)
+
+	statter.Timing("timing", 5, 1.0)
+	statter.TimingDuration("timing", 1500*time.Microsecond, 1.0)
+
+	sent := rs.GetSent()
+
+	if got, want := sent.SumCounter("count"), 8.0; got != want {
+		t.Errorf("SumCounter: got: %v, want: %v", got, want)
+	}
+	if got, want := sent.CollectTagged("a", "b").SumCounter("count"), 6.0; got != want {
+		t.Errorf("tagged SumCounter: got: %v, want: %v", got, want)
+	}
+	if got, ok := sent.LastGauge("gauge"); !ok || got != 12 {
+		t.Errorf("LastGauge: got: %v %v, want: 12", got, ok)
+	}
+	if _, ok := sent.LastGauge("count"); ok {
+		t.Errorf("LastGauge: expected no gauge")
+	}
+	if got, want := sent.SetMembers("set"), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SetMembers: got: %v, want: %v", got, want)
+	}
+	want := []time.Duration{5 * time.Millisecond, 1500 * time.Microsecond}
+	if got := sent.Timings("timing"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Timings: got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+package statsdtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+	"github.com/cactus/go-statsd-client/v6/statsd/parse"
+)
+
+// StatsSource is implemented by anything holding received stats, such as a
+// RecordingSender, a Server, or Stats themselves.
+type StatsSource interface {
+	Stats() Stats
+}
+
+// Stats returns s, making Stats a StatsSource.
+func (s Stats) Stats() Stats {
+	return s
+}
+
+// Assertions checks the stats of a StatsSource, reporting failures to a
+// test. See Assert.
+type Assertions struct {
+	t   testing.TB
+	src StatsSource
+}
+
+// Assert returns Assertions for the stats of src, reporting failures with
+// t.Errorf. The stats are read anew for each assertion. For example:
+//
+//	rs := statsdtest.NewRecordingSender()
+//	// ... use a client with rs
+//	statsdtest.Assert(t, rs).CounterEquals("requests", 10, statsd.Tag{"code", "200"})
+//
+// Each assertion returns whether it passed. Names are the bare stat names,
+// including any client prefix. Tags given to an assertion select the stats
+// having (at least) all of these tags.
+func Assert(t testing.TB, src StatsSource) *Assertions {
+	return &Assertions{t: t, src: src}
+}
+
+// CounterEquals asserts that the total of the counter name, corrected for
+// sample rates, is n.
+func (a *Assertions) CounterEquals(name string, n float64, tags ...statsd.Tag) bool {
+	a.t.Helper()
+
+	stats := a.selected(name, tags)
+	if got := stats.SumCounter(name); got != n {
+		return a.mismatch(stats, "counter", name, tags, "total", n, got)
+	}
+	return true
+}
+
+// GaugeEquals asserts that the final value of the gauge name is v.
+func (a *Assertions) GaugeEquals(name string, v float64, tags ...statsd.Tag) bool {
+	a.t.Helper()
+
+	stats := a.selected(name, tags)
+	got, ok := stats.LastGauge(name)
+	if !ok {
+		return a.mismatch(stats, "gauge", name, tags, "value", v, "none")
+	}
+	if got != v {
+		return a.mismatch(stats, "gauge", name, tags, "value", v, got)
+	}
+	return true
+}
+
+// TimingCount asserts that n values were sent for the timing name.
+func (a *Assertions) TimingCount(name string, n int, tags ...statsd.Tag) bool {
+	a.t.Helper()
+
+	stats := a.selected(name, tags)
+	if got := len(stats.Timings(name)); got != n {
+		return a.mismatch(stats, "timing", name, tags, "values", n, got)
+	}
+	return true
+}
+
+// NoUnparsed asserts that all stats could be parsed.
+func (a *Assertions) NoUnparsed() bool {
+	a.t.Helper()
+
+	if unparsed := a.src.Stats().Unparsed(); len(unparsed) != 0 {
+		return a.fail(unparsed, "got %d unparsed stats, want none", len(unparsed))
+	}
+	return true
+}
+
+// StrictlyParsed asserts that all stats are accepted by the strict parser of
+// the parse package, for the tag format tf. Use it to check that a client
+// only sends lines a statsd server would accept.
+func (a *Assertions) StrictlyParsed(tf statsd.TagFormat) bool {
+	a.t.Helper()
+
+	p := parse.Parser{TagFormat: tf}
+	var l parse.Line
+	var invalid Stats
+	var errs []string
+	for _, e := range a.src.Stats() {
+		if err := p.ParseLine(e.Raw, &l); err != nil {
+			invalid = append(invalid, e)
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(invalid) != 0 {
+		return a.fail(invalid, "got %d invalid stats, want none:\n\t%s", len(invalid), strings.Join(errs, "\n\t"))
+	}
+	return true
+}
+
+// NothingSent asserts that no stats were sent.
+func (a *Assertions) NothingSent() bool {
+	a.t.Helper()
+
+	if stats := a.src.Stats(); len(stats) != 0 {
+		return a.fail(stats, "got %d stats, want none", len(stats))
+	}
+	return true
+}
+
+// selected returns the stats named name, having all of tags.
+func (a *Assertions) selected(name string, tags []statsd.Tag) Stats {
+	return a.src.Stats().Collect(func(e Stat) bool {
+		if e.Name != name {
+			return false
+		}
+		for _, t := range tags {
+			if v, ok := e.TagValue(t[0]); !ok || v != t[1] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// maxListed is the number of stats listed in a failure message.
+const maxListed = 10
+
+// mismatch reports a wrong value for the stat name with tags, along with the
+// matching stats.
+func (a *Assertions) mismatch(stats Stats, kind, name string, tags []statsd.Tag, what string, want, got interface{}) bool {
+	a.t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s:\n\twant %s: %v\n\tgot %s:  %v", kind, describe(name, tags), what, want, what, got)
+	if len(stats) == 0 {
+		b.WriteString("\nno matching stats found")
+		if len(tags) != 0 {
+			if n := len(a.selected(name, nil)); n != 0 {
+				fmt.Fprintf(&b, " (%d with other tags)", n)
+			}
+		}
+	} else {
+		b.WriteString("\nmatching stats:")
+		list(&b, stats)
+	}
+	a.t.Errorf("%s", b.String())
+	return false
+}
+
+// fail reports a failed assertion, listing the offending stats.
+func (a *Assertions) fail(stats Stats, format string, args ...interface{}) bool {
+	a.t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, format, args...)
+	b.WriteString("\nsent:")
+	list(&b, stats)
+	a.t.Errorf("%s", b.String())
+	return false
+}
+
+// list writes the lines of up to maxListed stats to b.
+func list(b *strings.Builder, stats Stats) {
+	for i, e := range stats {
+		if i == maxListed {
+			fmt.Fprintf(b, "\n\t... and %d more", len(stats)-maxListed)
+			break
+		}
+		fmt.Fprintf(b, "\n\t%s", e.Raw)
+	}
+}
+
+// describe returns name, with tags if any, for failure messages.
+func describe(name string, tags []statsd.Tag) string {
+	if len(tags) == 0 {
+		return fmt.Sprintf("%q", name)
+	}
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = t[0] + ":" + t[1]
+	}
+	return fmt.Sprintf("%q [%s]", name, strings.Join(parts, ","))
+}
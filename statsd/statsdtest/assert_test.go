@@ -0,0 +1,146 @@
+package statsdtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+// failRecorder records the failures of assertions.
+type failRecorder struct {
+	testing.TB
+	failures []string
+}
+
+func (f *failRecorder) Helper() {}
+
+func (f *failRecorder) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	rs := NewRecordingSender()
+	statter, err := statsd.NewClientWithSender(rs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := &failRecorder{TB: t}
+	a := Assert(fr, rs)
+	a.NothingSent()
+
+	statter.Inc("count", 4, 1.0, statsd.Tag{"code", "200"}, statsd.Tag{"method", "GET"})
+	statter.Inc("count", 6, 1.0, statsd.Tag{"code", "200"})
+	statter.Inc("count", 1, 1.0, statsd.Tag{"code", "500"})
+	statter.Gauge("gauge", 3, 1.0)
+	statter.Timing("timing", 1, 1.0)
+	statter.Timing("timing", 2, 1.0)
+
+	passing := []bool{
+		a.CounterEquals("test.count", 11),
+		a.CounterEquals("test.count", 10, statsd.Tag{"code", "200"}),
+		a.CounterEquals("test.count", 4, statsd.Tag{"code", "200"}, statsd.Tag{"method", "GET"}),
+		a.CounterEquals("test.missing", 0),
+		a.GaugeEquals("test.gauge", 3),
+		a.TimingCount("test.timing", 2),
+		a.NoUnparsed(),
+	}
+	for i, ok := range passing {
+		if !ok {
+			t.Errorf("assertion %d failed", i)
+		}
+	}
+	if len(fr.failures) != 0 {
+		t.Fatalf("unexpected failures: %q", fr.failures)
+	}
+
+	failing := []bool{
+		a.CounterEquals("test.count", 1, statsd.Tag{"code", "500"}, statsd.Tag{"method", "GET"}),
+		a.CounterEquals("test.count", 5, statsd.Tag{"code", "500"}),
+		a.GaugeEquals("test.gauge", 4),
+		a.GaugeEquals("test.missing", 4),
+		a.TimingCount("test.timing", 1),
+		a.NothingSent(),
+	}
+	for i, ok := range failing {
+		if ok {
+			t.Errorf("assertion %d passed", i)
+		}
+	}
+
+	want := []string{
+		"counter \"test.count\" [code:500,method:GET]:\n\twant total: 1\n\tgot total:  0\nno matching stats found (3 with other tags)",
+		"counter \"test.count\" [code:500]:\n\twant total: 5\n\tgot total:  1\nmatching stats:\n\ttest.count:1|c|#code:500",
+		"gauge \"test.gauge\":\n\twant value: 4\n\tgot value:  3\nmatching stats:\n\ttest.gauge:3|g",
+		"gauge \"test.missing\":\n\twant value: 4\n\tgot value:  none\nno matching stats found",
+		"timing \"test.timing\":\n\twant values: 1\n\tgot values:  2\nmatching stats:\n\ttest.timing:1|ms\n\ttest.timing:2|ms",
+	}
+	if len(fr.failures) != len(failing) {
+		t.Fatalf("got %d failures, want %d: %q", len(fr.failures), len(failing), fr.failures)
+	}
+	for i, w := range want {
+		if fr.failures[i] != w {
+			t.Errorf("got failure:\n%s\nwant:\n%s", fr.failures[i], w)
+		}
+	}
+	if !strings.HasPrefix(fr.failures[5], "got 6 stats, want none\nsent:\n") {
+		t.Errorf("got failure: %s", fr.failures[5])
+	}
+}
+
+func TestAssertListLimit(t *testing.T) {
+	rs := NewRecordingSender()
+	statter, err := statsd.NewClientWithSender(rs, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxListed+2; i++ {
+		statter.Inc("count", 1, 1.0)
+	}
+
+	fr := &failRecorder{TB: t}
+	Assert(fr, rs).CounterEquals("count", 1)
+	if len(fr.failures) != 1 || !strings.HasSuffix(fr.failures[0], "\n\tcount:1|c\n\t... and 2 more") {
+		t.Fatalf("got failures: %q", fr.failures)
+	}
+	if n := strings.Count(fr.failures[0], "\n\tcount:1|c"); n != maxListed {
+		t.Fatalf("got %d stats listed, want %d", n, maxListed)
+	}
+}
+
+func TestAssertUnparsed(t *testing.T) {
+	fr := &failRecorder{TB: t}
+	if Assert(fr, ParseStats([]byte("foo:1|c\nbad"))).NoUnparsed() {
+		t.Fatal("expected NoUnparsed to fail")
+	}
+	if want := "got 1 unparsed stats, want none\nsent:\n\tbad"; len(fr.failures) != 1 || fr.failures[0] != want {
+		t.Errorf("got failures: %q", fr.failures)
+	}
+}
+
+func TestAssertStrictlyParsed(t *testing.T) {
+	rs := NewRecordingSender()
+	statter, err := statsd.NewClientWithSender(rs, "test", statsd.InfixComma)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statter.Inc("count", 1, 1.0, statsd.Tag{"code", "200"})
+	statter.Set("set", "member", 1.0)
+
+	fr := &failRecorder{TB: t}
+	if !Assert(fr, rs).StrictlyParsed(statsd.InfixComma) || len(fr.failures) != 0 {
+		t.Fatalf("unexpected failures: %q", fr.failures)
+	}
+
+	// an empty set member is not a valid line
+	statter.Set("set", "", 1.0)
+	if Assert(fr, rs).StrictlyParsed(statsd.InfixComma) {
+		t.Fatal("expected StrictlyParsed to fail")
+	}
+	want := "got 1 invalid stats, want none:\n\tline 1: invalid value: \"test.set:|s\"\nsent:\n\ttest.set:|s"
+	if len(fr.failures) != 1 || fr.failures[0] != want {
+		t.Errorf("got failures: %q", fr.failures)
+	}
+}
@@ -0,0 +1,107 @@
+package statsdtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+// FakeClock is a statsd.Clock whose time only moves when advanced, firing
+// its tickers deterministically. Set it as statsd.ClientConfig.Clock to flush
+// a buffered sender, or re-resolve a resolving sender, on demand.
+//
+// It should be constructed with NewFakeClock.
+type FakeClock struct {
+	m       sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFakeClock returns a new FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker firing every d, as the clock is advanced.
+// It panics if d is not positive, as time.NewTicker does.
+func (c *FakeClock) NewTicker(d time.Duration) statsd.Ticker {
+	if d <= 0 {
+		panic("statsdtest: non-positive interval for FakeClock.NewTicker")
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	t := &fakeTicker{
+		clock:  c,
+		period: d,
+		next:   c.now.Add(d),
+		c:      make(chan time.Time, 1),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing any tickers that are due.
+// Like a time.Ticker, a ticker whose previous tick was not yet received drops
+// further ticks.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if t.next.After(c.now) {
+			continue
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// Tickers returns the number of running (ie. not stopped) tickers. It may be
+// used to wait for a sender to start or stop.
+func (c *FakeClock) Tickers() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.tickers)
+}
+
+func (c *FakeClock) stop(t *fakeTicker) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for i, ct := range c.tickers {
+		if ct == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// fakeTicker is a statsd.Ticker of a FakeClock.
+type fakeTicker struct {
+	clock  *FakeClock
+	period time.Duration
+	// guarded by clock.m
+	next time.Time
+	c    chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.stop(t)
+}
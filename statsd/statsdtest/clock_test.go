@@ -0,0 +1,97 @@
+package statsdtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	ticker := clock.NewTicker(time.Second)
+
+	clock.Advance(500 * time.Millisecond)
+	if got := clock.Now(); !got.Equal(start.Add(500 * time.Millisecond)) {
+		t.Errorf("unexpected time: %s", got)
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("unexpected tick")
+	default:
+	}
+
+	// ticks not received are dropped
+	clock.Advance(3 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(3500 * time.Millisecond)) {
+			t.Errorf("unexpected tick time: %s", tick)
+		}
+	default:
+		t.Fatal("expected a tick")
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("unexpected second tick")
+	default:
+	}
+
+	// the next tick is due at 4s
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-ticker.C():
+	default:
+		t.Fatal("expected a tick")
+	}
+
+	if n := clock.Tickers(); n != 1 {
+		t.Errorf("expected 1 ticker, got %d", n)
+	}
+	ticker.Stop()
+	if n := clock.Tickers(); n != 0 {
+		t.Errorf("expected 0 tickers, got %d", n)
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("unexpected tick after Stop")
+	default:
+	}
+}
+
+func TestFakeClockBufferedFlush(t *testing.T) {
+	srv := NewServer(t)
+	clock := NewFakeClock(time.Now())
+	statter, err := statsd.NewClientWithConfig(&statsd.ClientConfig{
+		Address:       srv.Addr(),
+		Prefix:        "test",
+		UseBuffered:   true,
+		FlushInterval: time.Minute,
+		Clock:         clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statter.Close()
+
+	if n := clock.Tickers(); n != 1 {
+		t.Fatalf("expected the buffered sender to start 1 ticker, got %d", n)
+	}
+
+	statter.Inc("count", 3, 1.0)
+	clock.Advance(time.Minute)
+
+	ok := srv.WaitFor(func(s Stats) bool {
+		return s.SumCounter("test.count") == 3
+	}, 5*time.Second)
+	if !ok {
+		t.Fatalf("counter not flushed, got: %s", srv.Stats())
+	}
+
+	statter.Close()
+	if n := clock.Tickers(); n != 0 {
+		t.Errorf("expected the ticker to be stopped, got %d", n)
+	}
+}
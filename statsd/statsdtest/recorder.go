@@ -1,6 +1,7 @@
 package statsdtest
 
 import (
+	"bytes"
 	"errors"
 	"sync"
 )
@@ -9,9 +10,50 @@ import (
 // buffer that can be later inspected instead of sending to some server. It
 // should constructed with NewRecordingSender().
 type RecordingSender struct {
-	m      sync.Mutex
-	buffer Stats
-	closed bool
+	m       sync.Mutex
+	buffer  Stats
+	packets Packets
+	closed  bool
+}
+
+// Packet describes the payload of a single call to RecordingSender.Send, ie.
+// a single packet sent by a statsd.Client. It allows checking how stats are
+// packed, eg. by a BufferedSender.
+type Packet struct {
+	// Index is the position of the packet among all packets recorded.
+	Index int
+	// Size is the length of the payload in bytes.
+	Size int
+	// Lines is the number of stats in the payload.
+	Lines int
+	// First is the position, among all stats recorded, of the first stat of
+	// the payload.
+	First int
+	// Raw is (a copy of) the payload.
+	Raw []byte
+}
+
+// Packets is a list of Packet.
+type Packets []Packet
+
+// MaxSize returns the size of the largest packet, or 0 if there are none.
+func (p Packets) MaxSize() int {
+	max := 0
+	for _, e := range p {
+		if e.Size > max {
+			max = e.Size
+		}
+	}
+	return max
+}
+
+// Lines returns the total number of stats of the packets.
+func (p Packets) Lines() int {
+	n := 0
+	for _, e := range p {
+		n += e.Lines
+	}
+	return n
 }
 
 // NewRecordingSender creates a new RecordingSender for use by a statsd.Client.
@@ -39,24 +81,49 @@ func (rs *RecordingSender) GetSent() Stats {
 	return results
 }
 
+// Stats is the same as GetSent, making a RecordingSender a StatsSource.
+func (rs *RecordingSender) Stats() Stats {
+	return rs.GetSent()
+}
+
 // ClearSent locks the sender and clears any Stats that have been recorded.
 func (rs *RecordingSender) ClearSent() {
 	rs.m.Lock()
 	defer rs.m.Unlock()
 
 	rs.buffer = rs.buffer[:0]
+	rs.packets = rs.packets[:0]
+}
+
+// Packets returns the packets that have been sent, in order. Locks and copies
+// the current state of the sent Packets (including Packet.Raw).
+func (rs *RecordingSender) Packets() Packets {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	results := make(Packets, len(rs.packets))
+	for i, p := range rs.packets {
+		results[i] = p
+		results[i].Raw = append([]byte(nil), p.Raw...)
+	}
+	return results
 }
 
 // Send parses the provided []byte into stat objects and then appends these to
 // the buffer of sent stats. Buffer operations are synchronized so it is safe
 // to call this from multiple goroutines (though contenion will impact
 // performance so don't use this during a benchmark). Send treats '\n' as a
-// delimiter between multiple sats in the same []byte.
+// delimiter between multiple sats in the same []byte, ignoring trailing empty
+// lines (as produced by newline framed protocols, eg. over TCP). Each call is
+// also recorded as a Packet.
 //
 // Calling after the Sender has been closed will return an error (and not
 // mutate the buffer).
 func (rs *RecordingSender) Send(data []byte) (int, error) {
-	sent := ParseStats(data)
+	var sent Stats
+	if trimmed := bytes.TrimRight(data, "\n"); len(trimmed) > 0 {
+		sent = ParseStats(trimmed)
+	}
 
 	rs.m.Lock()
 	defer rs.m.Unlock()
@@ -64,6 +131,13 @@ func (rs *RecordingSender) Send(data []byte) (int, error) {
 		return 0, errors.New("writing to a closed sender")
 	}
 
+	rs.packets = append(rs.packets, Packet{
+		Index: len(rs.packets),
+		Size:  len(data),
+		Lines: len(sent),
+		First: len(rs.buffer),
+		Raw:   append([]byte(nil), data...),
+	})
 	rs.buffer = append(rs.buffer, sent...)
 	return len(data), nil
 }
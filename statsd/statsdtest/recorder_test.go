@@ -45,13 +45,104 @@ func TestRecordingSender(t *testing.T) {
 	msStr := string(strconv.AppendFloat([]byte(""), ms, 'f', -1, 64))
 
 	expected := Stats{
-		{[]byte("test.stat:4444|c"), "test.stat", "4444", "c", "", true},
-		{[]byte("test.stat:-5555|c"), "test.stat", "-5555", "c", "", true},
-		{[]byte("test.set-stat:some string|s"), "test.set-stat", "some string", "s", "", true},
-		{[]byte(fmt.Sprintf("test.timing:%s|ms", msStr)), "test.timing", msStr, "ms", "", true},
+		{[]byte("test.stat:4444|c"), "test.stat", "4444", "c", "", true, "test.stat", nil},
+		{[]byte("test.stat:-5555|c"), "test.stat", "-5555", "c", "", true, "test.stat", nil},
+		{[]byte("test.set-stat:some string|s"), "test.set-stat", "some string", "s", "", true, "test.set-stat", nil},
+		{[]byte(fmt.Sprintf("test.timing:%s|ms", msStr)), "test.timing", msStr, "ms", "", true, "test.timing", nil},
 	}
 
 	if !reflect.DeepEqual(sent, expected) {
 		t.Errorf("got: %s, want: %s", sent, expected)
 	}
 }
+
+func TestRecordingSenderTags(t *testing.T) {
+	for _, tf := range []statsd.TagFormat{statsd.SuffixOctothorpe, statsd.InfixComma, statsd.InfixSemicolon} {
+		rs := NewRecordingSender()
+		statter, err := statsd.NewClientWithSender(rs, "test", tf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statter.(*statsd.Client).SetSamplerFunc(AlwaysSample().Sample)
+
+		statter.Inc("stat", 1, 0.5, statsd.Tag{"a", "b"}, statsd.Tag{"c", "d"})
+		statter.Inc("stat", 2, 1.0, statsd.Tag{"a", "x"})
+
+		sent := rs.GetSent()
+		if len(sent.Unparsed()) != 0 {
+			t.Fatalf("format %d: unparsed stats: %s", tf, sent.Unparsed())
+		}
+		got := sent.CollectTagged("a", "b")
+		if len(got) != 1 {
+			t.Fatalf("format %d: got: %s", tf, got)
+		}
+		want := []statsd.Tag{{"a", "b"}, {"c", "d"}}
+		if got[0].Name != "test.stat" || got[0].Value != "1" || got[0].Rate != "0.500000" ||
+			!reflect.DeepEqual(got[0].Tags, want) {
+			t.Errorf("format %d: got: %+v", tf, got[0])
+		}
+	}
+}
+
+func TestRecordingSenderPackets(t *testing.T) {
+	rs := NewRecordingSender()
+	rs.Send([]byte("a:1|c\nb:2|c\n"))
+	rs.Send([]byte("c:3|c"))
+	rs.Send([]byte("\n"))
+
+	sent := rs.GetSent()
+	if len(sent) != 3 || len(sent.Unparsed()) != 0 {
+		t.Fatalf("expected 3 parsed stats, got: %s", sent)
+	}
+
+	expected := Packets{
+		{Index: 0, Size: 12, Lines: 2, First: 0, Raw: []byte("a:1|c\nb:2|c\n")},
+		{Index: 1, Size: 5, Lines: 1, First: 2, Raw: []byte("c:3|c")},
+		{Index: 2, Size: 1, Lines: 0, First: 3, Raw: []byte("\n")},
+	}
+	packets := rs.Packets()
+	if !reflect.DeepEqual(packets, expected) {
+		t.Errorf("got: %+v, want: %+v", packets, expected)
+	}
+	if packets.MaxSize() != 12 || packets.Lines() != 3 {
+		t.Errorf("got max size %d, lines %d", packets.MaxSize(), packets.Lines())
+	}
+
+	rs.ClearSent()
+	if n := len(rs.Packets()); n != 0 {
+		t.Errorf("expected no packets after ClearSent, got %d", n)
+	}
+}
+
+func TestRecordingSenderBufferedPacking(t *testing.T) {
+	const flushBytes = 64
+
+	rs := NewRecordingSender()
+	sender, err := statsd.NewBufferedSenderWithSender(rs, time.Hour, flushBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statter, err := statsd.NewClientWithSender(sender, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		statter.Inc("count", int64(i), 1.0)
+	}
+	statter.Close()
+
+	packets := rs.Packets()
+	if max := packets.MaxSize(); max > flushBytes {
+		t.Errorf("packet of %d bytes exceeds %d", max, flushBytes)
+	}
+	if n := packets.Lines(); n != 50 {
+		t.Errorf("expected 50 stats, got %d", n)
+	}
+	if len(packets) >= 50 {
+		t.Errorf("expected stats to be packed, got %d packets", len(packets))
+	}
+	if unparsed := rs.GetSent().Unparsed(); len(unparsed) != 0 {
+		t.Errorf("unparsed stats: %s", unparsed)
+	}
+}
@@ -0,0 +1,74 @@
+package statsdtest
+
+import (
+	"sync"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+// Sampler is a deterministic sampler, for testing sampled stats. It decides
+// whether stats with a rate below 1 are sent by following a script of
+// decisions, repeated once exhausted. Stats with a rate of 1 or more are
+// always sent, and do not use a decision.
+//
+// Use its Sample method with statsd.Client.SetSamplerFunc, or its SampleStat
+// method as statsd.ClientConfig.Sampler.
+//
+// It should be constructed with NewSampler, AlwaysSample or NeverSample.
+type Sampler struct {
+	m         sync.Mutex
+	decisions []bool
+	calls     int
+}
+
+// NewSampler returns a new Sampler following the decisions in order,
+// repeating them once exhausted. With no decisions, every stat is sent.
+func NewSampler(decisions ...bool) *Sampler {
+	return &Sampler{decisions: append([]bool(nil), decisions...)}
+}
+
+// AlwaysSample returns a new Sampler sending every stat.
+func AlwaysSample() *Sampler {
+	return NewSampler(true)
+}
+
+// NeverSample returns a new Sampler sending no stat with a rate below 1.
+func NeverSample() *Sampler {
+	return NewSampler(false)
+}
+
+// Sample is a statsd.SamplerFunc. It returns whether a stat with the given
+// rate is sent.
+func (s *Sampler) Sample(rate float32) bool {
+	if rate >= 1 {
+		return true
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.calls++
+	if len(s.decisions) == 0 {
+		return true
+	}
+	return s.decisions[(s.calls-1)%len(s.decisions)]
+}
+
+// SampleStat is a statsd.StatSamplerFunc. The stat and tags are ignored.
+func (s *Sampler) SampleStat(stat string, rate float32, tags []statsd.Tag) bool {
+	return s.Sample(rate)
+}
+
+// Calls returns the number of decisions made so far, ie. the number of stats
+// sampled with a rate below 1.
+func (s *Sampler) Calls() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.calls
+}
+
+// Reset restarts the script from its first decision, and resets Calls.
+func (s *Sampler) Reset() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.calls = 0
+}
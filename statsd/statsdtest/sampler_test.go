@@ -0,0 +1,66 @@
+package statsdtest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(true, false, false)
+
+	var got []bool
+	for i := 0; i < 5; i++ {
+		got = append(got, s.Sample(0.5))
+	}
+	if want := []bool{true, false, false, true, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expected %v", got, want)
+	}
+
+	// full rate stats use no decision
+	if !s.Sample(1) {
+		t.Error("expected full rate stat to be sent")
+	}
+	if n := s.Calls(); n != 5 {
+		t.Errorf("expected 5 calls, got %d", n)
+	}
+
+	s.Reset()
+	if !s.SampleStat("stat", 0.5, nil) || s.Calls() != 1 {
+		t.Error("expected Reset to restart the script")
+	}
+
+	if !AlwaysSample().Sample(0.1) {
+		t.Error("expected AlwaysSample to send")
+	}
+	if NeverSample().Sample(0.1) {
+		t.Error("expected NeverSample not to send")
+	}
+	if !NewSampler().Sample(0.1) {
+		t.Error("expected an empty script to send")
+	}
+}
+
+func TestSamplerClient(t *testing.T) {
+	rs := NewRecordingSender()
+	statter, err := statsd.NewClientWithSender(rs, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statter.Close()
+	statter.(*statsd.Client).SetSamplerFunc(NewSampler(false, true).Sample)
+
+	for i := 0; i < 4; i++ {
+		statter.Inc("count", 1, 0.5)
+	}
+	statter.Inc("full", 1, 1)
+
+	stats := rs.GetSent()
+	if n := len(stats); n != 3 {
+		t.Fatalf("expected 3 stats, got %d: %s", n, stats)
+	}
+	if got := stats.SumCounter("test.count"); got != 4 {
+		t.Errorf("expected sampled counter sum of 4, got %v", got)
+	}
+}
@@ -0,0 +1,275 @@
+package statsdtest
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ServerConfig holds the optional listeners of a Server.
+type ServerConfig struct {
+	// TCP determines whether the Server also listens on a random 127.0.0.1
+	// TCP port (see Server.TCPAddr), reading newline delimited stats.
+	TCP bool
+
+	// UnixPath, if set, is the path of a unix datagram socket the Server
+	// also listens on (see Server.UnixAddr).
+	UnixPath string
+}
+
+// Server is a fake statsd server listening on the loopback interface, which
+// parses every stat it receives with ParseStats. It allows exercising the
+// full network path of a statsd.Client (eg. a BufferedSender, or a
+// ResolvingSimpleSender) in tests.
+//
+// It should be constructed with NewServer or NewServerWithConfig.
+type Server struct {
+	udp  net.PacketConn
+	tcp  net.Listener
+	unix net.PacketConn
+
+	m     sync.Mutex
+	stats Stats
+	// closed (and replaced) whenever stats are received
+	changed chan struct{}
+	conns   map[net.Conn]struct{}
+	closed  bool
+
+	wg sync.WaitGroup
+}
+
+// NewServer returns a Server listening on a random 127.0.0.1 UDP port (see
+// Server.Addr). The Server is closed when the test completes (with go 1.14
+// or later, otherwise call Close).
+func NewServer(t testing.TB) *Server {
+	return NewServerWithConfig(t, nil)
+}
+
+// NewServerWithConfig is like NewServer, additionally listening as
+// configured by config.
+func NewServerWithConfig(t testing.TB, config *ServerConfig) *Server {
+	t.Helper()
+
+	if config == nil {
+		config = &ServerConfig{}
+	}
+
+	s := &Server{
+		changed: make(chan struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	// testing.TB has Cleanup since go 1.14
+	if c, ok := t.(interface{ Cleanup(func()) }); ok {
+		c.Cleanup(func() { s.Close() })
+	}
+
+	var err error
+	s.udp, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("statsdtest: udp listen: %s", err)
+	}
+	s.servePackets(s.udp)
+
+	if config.TCP {
+		s.tcp, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("statsdtest: tcp listen: %s", err)
+		}
+		s.wg.Add(1)
+		go s.acceptTCP()
+	}
+
+	if config.UnixPath != "" {
+		s.unix, err = net.ListenPacket("unixgram", config.UnixPath)
+		if err != nil {
+			t.Fatalf("statsdtest: unixgram listen: %s", err)
+		}
+		s.servePackets(s.unix)
+	}
+
+	return s
+}
+
+// Addr returns the UDP address of the Server, as "127.0.0.1:{port}".
+func (s *Server) Addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// TCPAddr returns the TCP address of the Server, or "" if it does not
+// listen on TCP.
+func (s *Server) TCPAddr() string {
+	if s.tcp == nil {
+		return ""
+	}
+	return s.tcp.Addr().String()
+}
+
+// UnixAddr returns the path of the unix datagram socket of the Server, or ""
+// if it does not listen on one.
+func (s *Server) UnixAddr() string {
+	if s.unix == nil {
+		return ""
+	}
+	return s.unix.LocalAddr().String()
+}
+
+// Stats returns a copy of the stats received so far.
+func (s *Server) Stats() Stats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.copyStats()
+}
+
+// Clear discards the stats received so far.
+func (s *Server) Clear() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.stats = nil
+}
+
+// WaitFor waits until pred returns true for the stats received, or until
+// timeout has passed, and returns the last result of pred.
+//
+// For example, to wait for a counter to reach 10:
+//
+//	ok := srv.WaitFor(func(s statsdtest.Stats) bool {
+//		return s.SumCounter("requests") >= 10
+//	}, time.Second)
+func (s *Server) WaitFor(pred func(Stats) bool, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.m.Lock()
+		stats := s.copyStats()
+		changed := s.changed
+		s.m.Unlock()
+
+		if pred(stats) {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return pred(s.Stats())
+		}
+	}
+}
+
+// Close stops the Server listening, removing its unix socket, if any. Close
+// is called automatically when the test completes, and may be called more
+// than once.
+func (s *Server) Close() error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return nil
+	}
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.m.Unlock()
+
+	var err error
+	if s.udp != nil {
+		err = s.udp.Close()
+	}
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+	if s.unix != nil {
+		s.unix.Close()
+		os.Remove(s.unix.LocalAddr().String())
+	}
+	s.wg.Wait()
+	return err
+}
+
+// copyStats returns a copy of the stats, to be called with s.m held.
+func (s *Server) copyStats() Stats {
+	stats := make(Stats, len(s.stats))
+	copy(stats, s.stats)
+	return stats
+}
+
+// record parses and records the stats in data. Trailing line breaks, as
+// sent by a BufferedSender, are ignored.
+func (s *Server) record(data []byte) {
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return
+	}
+	sent := ParseStats(data)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.stats = append(s.stats, sent...)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// servePackets records the stats received on conn, until it is closed.
+func (s *Server) servePackets(conn net.PacketConn) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			s.record(buf[:n])
+		}
+	}()
+}
+
+// acceptTCP serves TCP connections, until the listener is closed.
+func (s *Server) acceptTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+
+		s.m.Lock()
+		if s.closed {
+			s.m.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.m.Unlock()
+
+		s.wg.Add(1)
+		go s.serveTCP(conn)
+	}
+}
+
+// serveTCP records the newline delimited stats received on conn.
+func (s *Server) serveTCP(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.m.Lock()
+		delete(s.conns, conn)
+		s.m.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		s.record(scanner.Bytes())
+	}
+}
@@ -0,0 +1,134 @@
+package statsdtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer(t)
+	statter, err := statsd.NewClientWithConfig(&statsd.ClientConfig{
+		Address:       srv.Addr(),
+		Prefix:        "test",
+		UseBuffered:   true,
+		FlushInterval: 10 * time.Millisecond,
+		FlushBytes:    64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statter.Close()
+
+	for i := 0; i < 10; i++ {
+		statter.Inc("count", 1, 1.0, statsd.Tag{"i", fmt.Sprint(i)})
+	}
+
+	ok := srv.WaitFor(func(s Stats) bool {
+		return s.SumCounter("test.count") == 10
+	}, 5*time.Second)
+	if !ok {
+		t.Fatalf("counter not received, got: %s", srv.Stats())
+	}
+	if unparsed := srv.Stats().Unparsed(); len(unparsed) != 0 {
+		t.Errorf("unparsed stats: %s", unparsed)
+	}
+
+	srv.Clear()
+	if got := srv.Stats(); len(got) != 0 {
+		t.Errorf("expected no stats, got: %s", got)
+	}
+}
+
+func TestServerResolving(t *testing.T) {
+	srv := NewServer(t)
+	_, port, err := net.SplitHostPort(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statter, err := statsd.NewClientWithConfig(&statsd.ClientConfig{
+		Address:     net.JoinHostPort("localhost", port),
+		Prefix:      "test",
+		ResInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statter.Close()
+
+	statter.Gauge("gauge", 5, 1.0)
+	ok := srv.WaitFor(func(s Stats) bool {
+		v, ok := s.LastGauge("test.gauge")
+		return ok && v == 5
+	}, 5*time.Second)
+	if !ok {
+		t.Fatalf("gauge not received, got: %s", srv.Stats())
+	}
+}
+
+func TestServerTCPAndUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := NewServerWithConfig(t, &ServerConfig{
+		TCP:      true,
+		UnixPath: filepath.Join(dir, "statsd.sock"),
+	})
+
+	conn, err := net.Dial("tcp", srv.TCPAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "tcp.count:1|c\ntcp.count:2|c\n")
+
+	uconn, err := net.Dial("unixgram", srv.UnixAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uconn.Close()
+	// as sent by a BufferedSender
+	fmt.Fprint(uconn, "unix.count:3|c\n")
+
+	ok := srv.WaitFor(func(s Stats) bool {
+		return s.SumCounter("tcp.count") == 3 && s.SumCounter("unix.count") == 3
+	}, 5*time.Second)
+	if !ok {
+		t.Fatalf("stats not received, got: %s", srv.Stats())
+	}
+	if u := srv.Stats().Unparsed(); len(u) != 0 {
+		t.Fatalf("unexpected unparsed stats: %s", u)
+	}
+
+	// closing with an open connection does not block
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "statsd.sock")); !os.IsNotExist(err) {
+		t.Fatalf("expected the unix socket to be removed, got %v", err)
+	}
+}
+
+func TestServerWaitForTimeout(t *testing.T) {
+	srv := NewServer(t)
+	start := time.Now()
+	if srv.WaitFor(func(s Stats) bool { return len(s) > 0 }, 20*time.Millisecond) {
+		t.Fatal("expected WaitFor to time out")
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("WaitFor returned early")
+	}
+}
@@ -0,0 +1,227 @@
+package statsdtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+// UpdateEnv is the environment variable which, set to a true value (eg. 1),
+// makes every snapshot write its golden file, as SnapshotOptions.Update does.
+const UpdateEnv = "STATSDTEST_UPDATE"
+
+// updating returns whether the golden file is to be written.
+func updating(opts *SnapshotOptions) bool {
+	if opts.Update {
+		return true
+	}
+	b, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	return b
+}
+
+// SnapshotOptions holds the settings of SnapshotWithOptions.
+type SnapshotOptions struct {
+	// Update determines whether the golden file is written with the stats,
+	// instead of compared against them. See also UpdateEnv.
+	Update bool
+
+	// TimingResolution, if above 0, is the duration timing values are
+	// rounded to, eg. time.Second for timings of measured durations, which
+	// vary between runs. By default, timing values are kept as sent.
+	TimingResolution time.Duration
+
+	// SortTags determines whether the tags of each stat are sorted by key
+	// (and value), so that the order tags are given in does not matter.
+	SortTags bool
+}
+
+// Snapshot compares the stats sent to rs against the golden file path, using
+// the default SnapshotOptions. See SnapshotWithOptions.
+func Snapshot(t testing.TB, rs *RecordingSender, path string) bool {
+	t.Helper()
+	return SnapshotWithOptions(t, rs, path, nil)
+}
+
+// SnapshotWithOptions compares the stats sent to rs against the golden file
+// path, reporting any difference with t.Errorf, and returns whether they
+// match. This locks down the stats a piece of code sends, so that renamed
+// stats or changed tags show up in review as a changed golden file.
+//
+// The stats are normalized first: timing values are rounded and tags are
+// sorted if configured, and the lines are sorted. A relative path is relative to the
+// testdata directory. Sampled stats should be sent with a deterministic
+// Sampler.
+//
+// When opts.Update is set, or the UpdateEnv environment variable is true, the
+// golden file is written instead, eg. with
+//
+//	STATSDTEST_UPDATE=1 go test ./...
+func SnapshotWithOptions(t testing.TB, rs *RecordingSender, path string, opts *SnapshotOptions) bool {
+	t.Helper()
+
+	if opts == nil {
+		opts = &SnapshotOptions{}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join("testdata", path)
+	}
+
+	got := normalizeStats(rs.GetSent(), opts)
+
+	if updating(opts) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("snapshot: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(joinLines(got)), 0o644); err != nil {
+			t.Fatalf("snapshot: %s", err)
+		}
+		return true
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Errorf("snapshot %s does not exist, run the test with %s=1 to create it", path, UpdateEnv)
+		return false
+	}
+	if err != nil {
+		t.Fatalf("snapshot: %s", err)
+	}
+
+	want := splitLines(string(data))
+	missing, unexpected := diffLines(want, got)
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "stats differ from snapshot %s (run the test with %s=1 to accept them)", path, UpdateEnv)
+	for _, l := range missing {
+		b.WriteString("\n- " + l)
+	}
+	for _, l := range unexpected {
+		b.WriteString("\n+ " + l)
+	}
+	t.Errorf("%s", b.String())
+	return false
+}
+
+// normalizeStats returns the sorted, normalized lines of stats.
+func normalizeStats(stats Stats, opts *SnapshotOptions) []string {
+	lines := make([]string, 0, len(stats))
+	for _, s := range stats {
+		if len(s.Raw) == 0 {
+			continue
+		}
+		lines = append(lines, normalizeStat(s, opts))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// normalizeStat returns the line of s, with its timing value rounded and its
+// tags sorted according to opts. Unparsed stats are returned as sent.
+func normalizeStat(s Stat, opts *SnapshotOptions) string {
+	if !s.Parsed {
+		return string(s.Raw)
+	}
+
+	value := s.Value
+	if res := opts.TimingResolution; s.Type() == TypeTiming && res > 0 {
+		if ms, err := s.Float64(); err == nil {
+			resMs := float64(res) / float64(time.Millisecond)
+			value = strconv.FormatFloat(math.Round(ms/resMs)*resMs, 'f', -1, 64)
+		}
+	}
+
+	tags := s.Tags
+	if opts.SortTags && len(tags) > 1 {
+		tags = append([]statsd.Tag(nil), tags...)
+		sort.Slice(tags, func(i, j int) bool {
+			if tags[i][0] != tags[j][0] {
+				return tags[i][0] < tags[j][0]
+			}
+			return tags[i][1] < tags[j][1]
+		})
+	}
+
+	var b strings.Builder
+	b.WriteString(s.Name)
+	infix := s.Stat != s.Name
+	if infix {
+		// the separator following the name, ',' or ';'
+		sep := s.Stat[len(s.Name)]
+		for _, t := range tags {
+			b.WriteByte(sep)
+			writeTag(&b, t, '=')
+		}
+	}
+	b.WriteString(":" + value + "|" + s.Tag)
+	if s.Rate != "" {
+		b.WriteString("|@" + s.Rate)
+	}
+	if !infix && len(tags) > 0 {
+		b.WriteString("|#")
+		for i, t := range tags {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeTag(&b, t, ':')
+		}
+	}
+	return b.String()
+}
+
+func writeTag(b *strings.Builder, t statsd.Tag, sep byte) {
+	b.WriteString(t[0])
+	if t[1] != "" {
+		b.WriteByte(sep)
+		b.WriteString(t[1])
+	}
+}
+
+// diffLines returns the lines of want missing from got, and the lines of got
+// not in want, counting repeated lines.
+func diffLines(want, got []string) (missing, unexpected []string) {
+	counts := make(map[string]int, len(want))
+	for _, l := range want {
+		counts[l]++
+	}
+	for _, l := range got {
+		if counts[l] > 0 {
+			counts[l]--
+			continue
+		}
+		unexpected = append(unexpected, l)
+	}
+	for _, l := range want {
+		if counts[l] > 0 {
+			counts[l]--
+			missing = append(missing, l)
+		}
+	}
+	return missing, unexpected
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,146 @@
+package statsdtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
+)
+
+// sendSnapshotStats sends the stats of the snapshot tests to rs, with tags in
+// the given order.
+func sendSnapshotStats(t *testing.T, rs *RecordingSender, tf statsd.TagFormat, tags ...statsd.Tag) {
+	t.Helper()
+	statter, err := statsd.NewClientWithSender(rs, "svc", tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statter.(*statsd.Client).SetSamplerFunc(AlwaysSample().Sample)
+
+	statter.Timing("latency", 1234, 1.0, tags...)
+	statter.Inc("requests", 1, 0.5, tags...)
+	statter.Gauge("conns", 3, 1.0)
+	statter.TimingDuration("latency", 940*time.Millisecond, 1.0, tags...)
+	statter.Inc("requests", 1, 0.5, tags...)
+}
+
+func TestSnapshot(t *testing.T) {
+	tags := []statsd.Tag{{"route", "/"}, {"code", "200"}}
+
+	rs := NewRecordingSender()
+	sendSnapshotStats(t, rs, statsd.SuffixOctothorpe, tags...)
+	Snapshot(t, rs, "snapshot.golden")
+
+	rs = NewRecordingSender()
+	sendSnapshotStats(t, rs, statsd.InfixSemicolon, tags...)
+	opts := &SnapshotOptions{SortTags: true, TimingResolution: time.Second}
+	SnapshotWithOptions(t, rs, "snapshot_infix.golden", opts)
+
+	// with sorted tags, tag order does not matter
+	rs = NewRecordingSender()
+	sendSnapshotStats(t, rs, statsd.InfixSemicolon, tags[1], tags[0])
+	SnapshotWithOptions(t, rs, "snapshot_infix.golden", opts)
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.golden")
+
+	rs := NewRecordingSender()
+	fr := &failRecorder{TB: t}
+	if Snapshot(fr, rs, path) || len(fr.failures) != 1 ||
+		!strings.Contains(fr.failures[0], "does not exist") {
+		t.Fatalf("expected a missing snapshot failure, got %q", fr.failures)
+	}
+
+	sendSnapshotStats(t, rs, statsd.SuffixOctothorpe, statsd.Tag{"code", "200"})
+	if !SnapshotWithOptions(t, rs, path, &SnapshotOptions{Update: true}) {
+		t.Fatal("expected update to pass")
+	}
+	want := "svc.conns:3|g\n" +
+		"svc.latency:1234|ms|#code:200\n" +
+		"svc.latency:940|ms|#code:200\n" +
+		"svc.requests:1|c|@0.500000|#code:200\n" +
+		"svc.requests:1|c|@0.500000|#code:200\n"
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != want {
+		t.Fatalf("unexpected snapshot %q (%v)", data, err)
+	}
+	if !Snapshot(t, rs, path) {
+		t.Fatal("expected an unchanged snapshot to pass")
+	}
+
+	// a renamed stat and a changed tag
+	rs = NewRecordingSender()
+	statter, err := statsd.NewClientWithSender(rs, "svc", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statter.(*statsd.Client).SetSamplerFunc(AlwaysSample().Sample)
+	statter.Gauge("connections", 3, 1.0)
+	statter.Timing("latency", 1234, 1.0, statsd.Tag{"code", "200"})
+	statter.TimingDuration("latency", 940*time.Millisecond, 1.0, statsd.Tag{"code", "200"})
+	statter.Inc("requests", 1, 0.5, statsd.Tag{"code", "200"})
+	statter.Inc("requests", 1, 0.5, statsd.Tag{"code", "500"})
+
+	fr = &failRecorder{TB: t}
+	if Snapshot(fr, rs, path) || len(fr.failures) != 1 {
+		t.Fatalf("expected a single failure, got %q", fr.failures)
+	}
+	for _, l := range []string{
+		"\n- svc.conns:3|g",
+		"\n- svc.requests:1|c|@0.500000|#code:200",
+		"\n+ svc.connections:3|g",
+		"\n+ svc.requests:1|c|@0.500000|#code:500",
+	} {
+		if !strings.Contains(fr.failures[0], l) {
+			t.Errorf("expected %q in failure, got %q", l, fr.failures[0])
+		}
+	}
+}
+
+func TestSnapshotUpdateEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.golden")
+
+	os.Setenv(UpdateEnv, "1")
+	defer os.Unsetenv(UpdateEnv)
+
+	rs := NewRecordingSender()
+	rs.Send([]byte("svc.count:1|c"))
+	if !Snapshot(t, rs, path) {
+		t.Fatal("expected update to pass")
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "svc.count:1|c\n" {
+		t.Fatalf("unexpected snapshot %q (%v)", data, err)
+	}
+}
+
+func TestSnapshotTimingResolution(t *testing.T) {
+	s := ParseStats([]byte("latency:1234.5|ms"))[0]
+	for _, tt := range []struct {
+		res  time.Duration
+		want string
+	}{
+		{0, "latency:1234.5|ms"},
+		{-1, "latency:1234.5|ms"},
+		{time.Second, "latency:1000|ms"},
+		{10 * time.Millisecond, "latency:1230|ms"},
+		{time.Millisecond / 2, "latency:1234.5|ms"},
+	} {
+		if got := normalizeStat(s, &SnapshotOptions{TimingResolution: tt.res}); got != tt.want {
+			t.Errorf("resolution %s: got %q, want %q", tt.res, got, tt.want)
+		}
+	}
+}
@@ -3,13 +3,20 @@ package statsdtest
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
 )
 
 // Stat contains the raw and extracted stat information from a stat that was
 // sent by the RecordingSender. Raw will always have the content that was
 // consumed for this specific stat and Parsed will be set if no errors were hit
 // pulling information out of it.
+//
+// Stat holds the stat name as sent, including any infix tags, while Name
+// holds the bare name. Tags holds the infix or suffix tags, in order.
 type Stat struct {
 	Raw    []byte
 	Stat   string
@@ -17,6 +24,8 @@ type Stat struct {
 	Tag    string
 	Rate   string
 	Parsed bool
+	Name   string
+	Tags   []statsd.Tag
 }
 
 // String fulfils the stringer interface
@@ -24,11 +33,85 @@ func (s *Stat) String() string {
 	return fmt.Sprintf("%s %s %s", s.Stat, s.Value, s.Rate)
 }
 
+// StatType is the type of a Stat, as given by its type tag.
+type StatType int
+
+const (
+	// TypeUnknown is the type of a Stat with an unknown (or missing) type tag.
+	TypeUnknown StatType = iota
+	TypeCounter
+	TypeGauge
+	TypeTiming
+	TypeSet
+)
+
+// Type returns the type of the stat.
+func (s *Stat) Type() StatType {
+	switch s.Tag {
+	case "c":
+		return TypeCounter
+	case "g":
+		return TypeGauge
+	case "ms":
+		return TypeTiming
+	case "s":
+		return TypeSet
+	}
+	return TypeUnknown
+}
+
+// Int64 returns the value of the stat as an integer.
+func (s *Stat) Int64() (int64, error) {
+	return strconv.ParseInt(s.Value, 10, 64)
+}
+
+// Float64 returns the value of the stat as a float.
+func (s *Stat) Float64() (float64, error) {
+	return strconv.ParseFloat(s.Value, 64)
+}
+
+// SampleRate returns the sample rate of the stat, which is 1 if the stat has
+// none.
+func (s *Stat) SampleRate() (float64, error) {
+	if s.Rate == "" {
+		return 1, nil
+	}
+	return strconv.ParseFloat(s.Rate, 64)
+}
+
+// Duration returns the value of a timing stat (in milliseconds) as a
+// time.Duration.
+func (s *Stat) Duration() (time.Duration, error) {
+	ms, err := s.Float64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// TagValue returns the value of the first tag with key key, and whether the
+// stat has such a tag.
+func (s *Stat) TagValue(key string) (string, bool) {
+	for _, t := range s.Tags {
+		if t[0] == key {
+			return t[1], true
+		}
+	}
+	return "", false
+}
+
 // ParseStats takes a sequence of bytes destined for a Statsd server and parses
 // it out into one or more Stat structs. Each struct includes both the raw
 // bytes (copied, so the src []byte may be reused if desired) as well as each
 // component it was able to parse out. If parsing was incomplete Stat.Parsed
 // will be set to false but no error is returned / kept.
+//
+// Tags in any of the statsd.TagFormat dialects are understood: infix tags
+// (statsd.InfixComma or statsd.InfixSemicolon) following the name, or suffix
+// tags (statsd.SuffixOctothorpe) following the type tag or sample rate.
+//
+// ParseStats is lenient, extracting what it can from invalid stats. See the
+// parse package for a strict parser, and Assertions.StrictlyParsed.
 func ParseStats(src []byte) Stats {
 	d := make([]byte, len(src))
 	copy(d, src)
@@ -48,8 +131,10 @@ func ParseStats(src []byte) Stats {
 			continue
 		}
 		ss.Stat = string(e[0:marker])
+		ss.Name, ss.Tags = parseInfixTags(ss.Stat)
 
-		// stat data folows ':' with the form {value}|{type tag}[|@{sample rate}]
+		// stat data folows ':' with the form
+		// {value}|{type tag}[|@{sample rate}][|#{suffix tags}]
 		e = e[marker+1:]
 		marker = bytes.IndexByte(e, '|')
 		if marker == -1 {
@@ -58,25 +143,63 @@ func ParseStats(src []byte) Stats {
 
 		ss.Value = string(e[:marker])
 
-		e = e[marker+1:]
-		marker = bytes.IndexByte(e, '|')
-		if marker == -1 {
-			// no sample rate
-			ss.Tag = string(e)
-		} else {
-			ss.Tag = string(e[:marker])
-			e = e[marker+1:]
-			if len(e) == 0 || e[0] != '@' {
-				// sample rate should be prefixed with '@'; bail otherwise
-				continue
+		fields := bytes.Split(e[marker+1:], []byte{'|'})
+		ss.Tag = string(fields[0])
+		ss.Parsed = parseOptionalFields(ss, fields[1:])
+	}
+
+	return result
+}
+
+// parseInfixTags splits a stat name with any infix tags into the bare name
+// and the tags.
+func parseInfixTags(stat string) (string, []statsd.Tag) {
+	sep := ","
+	if strings.Contains(stat, ";") {
+		sep = ";"
+	}
+
+	parts := strings.Split(stat, sep)
+	if len(parts) == 1 {
+		return stat, nil
+	}
+
+	tags := make([]statsd.Tag, len(parts)-1)
+	for i, p := range parts[1:] {
+		tags[i] = splitTag(p, "=")
+	}
+	return parts[0], tags
+}
+
+// parseOptionalFields parses the sample rate and suffix tags fields of a stat
+// into ss, returning whether they were valid.
+func parseOptionalFields(ss *Stat, fields [][]byte) bool {
+	seenRate, seenTags := false, false
+	for _, f := range fields {
+		switch {
+		case len(f) > 0 && f[0] == '@' && !seenRate:
+			// sample rate should be prefixed with '@'
+			seenRate = true
+			ss.Rate = string(f[1:])
+		case len(f) > 0 && f[0] == '#' && !seenTags:
+			seenTags = true
+			for _, t := range strings.Split(string(f[1:]), ",") {
+				ss.Tags = append(ss.Tags, splitTag(t, ":"))
 			}
-			ss.Rate = string(e[1:])
+		default:
+			return false
 		}
-
-		ss.Parsed = true
 	}
+	return true
+}
 
-	return result
+// splitTag splits a key and value joined by sep into a Tag. A tag without
+// sep has an empty value.
+func splitTag(s, sep string) statsd.Tag {
+	if i := strings.Index(s, sep); i >= 0 {
+		return statsd.Tag{s[:i], s[i+len(sep):]}
+	}
+	return statsd.Tag{s, ""}
 }
 
 // Stats is a slice of Stat
@@ -94,6 +217,15 @@ func (s Stats) Unparsed() Stats {
 	return r
 }
 
+// CollectTagged returns all data sent with the tag key having the value
+// value.
+func (s Stats) CollectTagged(key, value string) Stats {
+	return s.Collect(func(e Stat) bool {
+		v, ok := e.TagValue(key)
+		return ok && v == value
+	})
+}
+
 // CollectNamed returns all data sent for a given stat name.
 func (s Stats) CollectNamed(statName string) Stats {
 	return s.Collect(func(e Stat) bool {
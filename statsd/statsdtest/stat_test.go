@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v6/statsd"
 )
 
 type parsingTestCase struct {
@@ -17,6 +20,7 @@ var (
 	bsnoStat        = Stat{
 		Raw:    badStatNameOnly,
 		Stat:   "foo.bar.baz",
+		Name:   "foo.bar.baz",
 		Parsed: false,
 	}
 
@@ -24,6 +28,7 @@ var (
 	gworStat         = Stat{
 		Raw:    gaugeWithoutRate,
 		Stat:   "foo.bar.baz",
+		Name:   "foo.bar.baz",
 		Value:  "1.000",
 		Tag:    "g",
 		Parsed: true,
@@ -33,6 +38,7 @@ var (
 	cwrStat         = Stat{
 		Raw:    counterWithRate,
 		Stat:   "foo.bar.baz",
+		Name:   "foo.bar.baz",
 		Value:  "1.000",
 		Tag:    "c",
 		Rate:   "0.75",
@@ -152,3 +158,87 @@ func TestStatsValues(t *testing.T) {
 		t.Errorf("got: %+v, want: %+v", got, want)
 	}
 }
+
+func TestParseTags(t *testing.T) {
+	tags := []statsd.Tag{{"a", "b"}, {"c", "d"}}
+	cases := []struct {
+		name string
+		sent string
+		want Stat
+	}{
+		{"suffix",
+			"foo:1|c|#a:b,c:d",
+			Stat{Stat: "foo", Name: "foo", Value: "1", Tag: "c", Tags: tags, Parsed: true}},
+		{"suffix with rate",
+			"foo:1|c|@0.5|#a:b,c:d",
+			Stat{Stat: "foo", Name: "foo", Value: "1", Tag: "c", Rate: "0.5", Tags: tags, Parsed: true}},
+		{"suffix before rate",
+			"foo:1|c|#a:b,c:d|@0.5",
+			Stat{Stat: "foo", Name: "foo", Value: "1", Tag: "c", Rate: "0.5", Tags: tags, Parsed: true}},
+		{"suffix without value",
+			"foo:1|c|#a",
+			Stat{Stat: "foo", Name: "foo", Value: "1", Tag: "c", Tags: []statsd.Tag{{"a", ""}}, Parsed: true}},
+		{"infix comma",
+			"foo,a=b,c=d:1|c|@0.5",
+			Stat{Stat: "foo,a=b,c=d", Name: "foo", Value: "1", Tag: "c", Rate: "0.5", Tags: tags, Parsed: true}},
+		{"infix semicolon",
+			"foo;a=b;c=d:1|c",
+			Stat{Stat: "foo;a=b;c=d", Name: "foo", Value: "1", Tag: "c", Tags: tags, Parsed: true}},
+		{"repeated rate",
+			"foo:1|c|@0.5|@0.5",
+			Stat{Stat: "foo", Name: "foo", Value: "1", Tag: "c", Rate: "0.5", Parsed: false}},
+		{"unknown field",
+			"foo:1|c|x",
+			Stat{Stat: "foo", Name: "foo", Value: "1", Tag: "c", Parsed: false}},
+	}
+
+	for _, c := range cases {
+		c.want.Raw = []byte(c.sent)
+		got := ParseStats([]byte(c.sent))
+		if !reflect.DeepEqual(got, Stats{c.want}) {
+			t.Errorf("%s: got: %+v, want: %+v", c.name, got, Stats{c.want})
+		}
+	}
+}
+
+func TestStatsCollectTagged(t *testing.T) {
+	start := ParseStats([]byte("foo:1|c|#a:b\nfoo,a=c:1|c\nfoo;a=b:2|c\nfoo:3|c"))
+	got := start.CollectTagged("a", "b").Values()
+	want := []string{"1", "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestStatAccessors(t *testing.T) {
+	s := ParseStats([]byte("foo:1.5|ms|@0.25"))[0]
+	if s.Type() != TypeTiming {
+		t.Errorf("got type: %v, want: %v", s.Type(), TypeTiming)
+	}
+	if v, err := s.Float64(); err != nil || v != 1.5 {
+		t.Errorf("Float64: got: %v %v", v, err)
+	}
+	if _, err := s.Int64(); err == nil {
+		t.Errorf("Int64: expected an error")
+	}
+	if r, err := s.SampleRate(); err != nil || r != 0.25 {
+		t.Errorf("SampleRate: got: %v %v", r, err)
+	}
+	if d, err := s.Duration(); err != nil || d != 1500*time.Microsecond {
+		t.Errorf("Duration: got: %v %v", d, err)
+	}
+
+	s = ParseStats([]byte("foo:-3|c"))[0]
+	if v, err := s.Int64(); err != nil || v != -3 {
+		t.Errorf("Int64: got: %v %v", v, err)
+	}
+	if r, err := s.SampleRate(); err != nil || r != 1 {
+		t.Errorf("SampleRate: got: %v %v", r, err)
+	}
+
+	for tag, want := range map[string]StatType{"c": TypeCounter, "g": TypeGauge, "s": TypeSet, "h": TypeUnknown} {
+		if got := (&Stat{Tag: tag}).Type(); got != want {
+			t.Errorf("%s: got type: %v, want: %v", tag, got, want)
+		}
+	}
+}
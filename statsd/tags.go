@@ -48,6 +48,10 @@ const (
 	SuffixOctothorpe TagFormat = 1 << iota
 	InfixSemicolon
 	InfixComma
+	// InfluxLine is not a statsd tag dialect, but switches the client to
+	// emitting InfluxDB line protocol instead of statsd lines. Tags are written
+	// as line protocol tags, and each line ends with a timestamp.
+	InfluxLine
 
 	AllInfix  = InfixSemicolon | InfixComma
 	AllSuffix = SuffixOctothorpe
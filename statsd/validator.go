@@ -7,25 +7,141 @@ package statsd
 import (
 	"fmt"
 	"net"
-	"regexp"
 )
 
 // The ValidatorFunc type defines a function that can serve
 // as a stat name validation function.
 type ValidatorFunc func(string) error
 
-var safeName = regexp.MustCompile(`^[a-zA-Z0-9\-_.]+$`)
+// ValidatorPolicy determines what a Client does with a stat whose name fails
+// validation.
+type ValidatorPolicy uint8
+
+const (
+	// ValidatorReject returns the validation error from the stat method.
+	// This is the default.
+	ValidatorReject ValidatorPolicy = iota
+	// ValidatorDrop silently discards the stat.
+	ValidatorDrop
+	// ValidatorSanitize rewrites the name with SanitizeName, and sends the stat
+	// if the rewritten name passes validation.
+	ValidatorSanitize
+)
+
+// safeName is a lookup table of the characters accepted by CheckName:
+// [a-zA-Z0-9\-_.]
+var safeName = func() (t [256]bool) {
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = true
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		t[c] = true
+	}
+	for c := '0'; c <= '9'; c++ {
+		t[c] = true
+	}
+	t['-'] = true
+	t['_'] = true
+	t['.'] = true
+	return t
+}()
 
 // CheckName may be used to validate whether a stat name contains invalid
 // characters. If invalid characters are found, the function will return an
 // error.
 func CheckName(stat string) error {
-	if !safeName.MatchString(stat) {
+	if stat == "" {
 		return fmt.Errorf("invalid stat name: %s", stat)
 	}
+	for i := 0; i < len(stat); i++ {
+		if !safeName[stat[i]] {
+			return fmt.Errorf("invalid stat name: %s", stat)
+		}
+	}
 	return nil
 }
 
+// SanitizeName returns stat with every character not accepted by CheckName
+// replaced with an underscore.
+func SanitizeName(stat string) string {
+	b := []byte(stat)
+	for i, c := range b {
+		if !safeName[c] {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// validation is the (possibly cached) result of validating a stat name.
+type validation struct {
+	// rewritten name, or "" if the name is used unchanged
+	name string
+	// whether the stat should be silently dropped
+	drop bool
+	err  error
+}
+
+// nameValidator applies a ValidatorFunc and ValidatorPolicy to full stat
+// names, optionally caching the results.
+type nameValidator struct {
+	validate ValidatorFunc
+	policy   ValidatorPolicy
+	// cache of results by name, or nil
+	cache *nameCache
+}
+
+// newNameValidator returns a nameValidator, or nil if fn is nil.
+// cacheSize is the maximum number of cached names, or 0 to disable caching.
+func newNameValidator(fn ValidatorFunc, policy ValidatorPolicy, cacheSize int) *nameValidator {
+	if fn == nil {
+		return nil
+	}
+
+	v := &nameValidator{
+		validate: fn,
+		policy:   policy,
+	}
+	if cacheSize > 0 {
+		v.cache = newNameCache(cacheSize)
+	}
+	return v
+}
+
+// check validates the full stat name prefix.stat.
+func (v *nameValidator) check(prefix, stat string) validation {
+	if v.cache == nil {
+		return v.run(joinName(prefix, stat))
+	}
+
+	if r, ok := v.cache.get(prefix, stat); ok {
+		return r.(validation)
+	}
+
+	name := joinName(prefix, stat)
+	return v.cache.add(name, v.run(name)).(validation)
+}
+
+// run validates name and applies the policy.
+func (v *nameValidator) run(name string) validation {
+	err := v.validate(name)
+	if err == nil {
+		return validation{}
+	}
+
+	switch v.policy {
+	case ValidatorDrop:
+		return validation{drop: true}
+	case ValidatorSanitize:
+		clean := SanitizeName(name)
+		if err := v.validate(clean); err != nil {
+			return validation{err: err}
+		}
+		return validation{name: clean}
+	}
+	return validation{err: err}
+}
+
 func mustBeIP(hostport string) bool {
 	host, _, err := net.SplitHostPort(hostport)
 	if err != nil {
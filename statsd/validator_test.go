@@ -4,7 +4,10 @@
 
 package statsd
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 var validatorTests = []struct {
 	Stat  string
@@ -28,3 +31,100 @@ func TestValidator(t *testing.T) {
 		}
 	}
 }
+
+func TestSanitizeName(t *testing.T) {
+	for _, tt := range validatorTests {
+		got := SanitizeName(tt.Stat)
+		if err := CheckName(got); err != nil {
+			t.Fatal(err)
+		}
+		if tt.Valid && got != tt.Stat {
+			t.Fatalf("valid name %s should be unchanged, got %s", tt.Stat, got)
+		}
+	}
+}
+
+func TestClientValidator(t *testing.T) {
+	validatorClientTests := []struct {
+		Policy    ValidatorPolicy
+		CacheSize int
+		Stat      string
+		Expected  string
+		Err       bool
+	}{
+		{ValidatorReject, 0, "count", "test.count:1|c", false},
+		{ValidatorReject, 0, "co@unt", "", true},
+		{ValidatorReject, 8, "co@unt", "", true},
+		{ValidatorDrop, 0, "count", "test.count:1|c", false},
+		{ValidatorDrop, 0, "co@unt", "", false},
+		{ValidatorDrop, 8, "co@unt", "", false},
+		{ValidatorSanitize, 0, "co@unt", "test.co_unt:1|c", false},
+		{ValidatorSanitize, 8, "co@unt", "test.co_unt:1|c", false},
+	}
+
+	l, err := newUDPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, tt := range validatorClientTests {
+		config := &ClientConfig{
+			Address:            l.LocalAddr().String(),
+			Prefix:             "test",
+			Validator:          CheckName,
+			ValidatorPolicy:    tt.Policy,
+			ValidatorCacheSize: tt.CacheSize,
+		}
+
+		c, err := NewClientWithConfig(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// send twice, to exercise the cache
+		for i := 0; i < 2; i++ {
+			err = c.Inc(tt.Stat, 1, 1.0)
+			if tt.Err != (err != nil) {
+				c.Close()
+				t.Fatalf("%s: unexpected error result: %v", tt.Stat, err)
+			}
+			if tt.Expected == "" {
+				continue
+			}
+
+			data := make([]byte, 128)
+			_, _, err = l.ReadFrom(data)
+			if err != nil {
+				c.Close()
+				t.Fatal(err)
+			}
+
+			data = bytes.TrimRight(data, "\x00")
+			if !bytes.Equal(data, []byte(tt.Expected)) {
+				c.Close()
+				t.Fatalf("got '%s' expected '%s'", data, tt.Expected)
+			}
+		}
+		c.Close()
+	}
+}
+
+func TestValidatorCacheBounded(t *testing.T) {
+	calls := 0
+	v := newNameValidator(func(s string) error {
+		calls++
+		return CheckName(s)
+	}, ValidatorReject, 2)
+
+	for _, name := range []string{"a", "b", "a", "b", "c", "a"} {
+		if r := v.check("", name); r.err != nil {
+			t.Fatal(r.err)
+		}
+	}
+	if len(v.cache.m) > 2 {
+		t.Fatalf("cache exceeded its bound: %d", len(v.cache.m))
+	}
+	if calls != 4 {
+		t.Fatalf("expected 4 validator calls, got %d", calls)
+	}
+}